@@ -1,12 +1,20 @@
 package main
 
 import (
+	"context"
 	"log"
 	"notification-system/pkg/api"
 	"notification-system/pkg/config"
 	"notification-system/pkg/queue"
+	"notification-system/pkg/ratelimit"
+	"notification-system/pkg/relay"
 	"notification-system/pkg/storage"
+	"notification-system/pkg/stream"
 	"notification-system/pkg/validation"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 )
 
 func main() {
@@ -15,6 +23,14 @@ func main() {
 		log.Fatalf("Error loading configuration: %v", err)
 	}
 
+	// Shut down on SIGINT or SIGTERM, a second signal kills the process right away
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
 	db, err := storage.NewDatabase(cfg.Database)
 	if err != nil {
 		log.Fatalf("Error initializing database: %v", err)
@@ -27,9 +43,40 @@ func main() {
 	}
 	defer q.Close()
 
+	// Publish notifications left in the outbox, e.g. when publishing failed right after saving them
+	var background sync.WaitGroup
+	outboxRelay := relay.NewRelay(db, q, cfg.Relay)
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		outboxRelay.Start(ctx)
+	}()
+
+	// Stream the status changes written by all instances and workers to the clients of this instance
+	listener, err := storage.NewStatusListener(cfg.Database)
+	if err != nil {
+		log.Fatalf("Error listening for status changes: %v", err)
+	}
+	// The server closes the broker and with it the listener on shutdown
+	broker := stream.NewBroker(listener)
+	go broker.Start()
+
+	// Rate limits are kept per instance unless they are shared through Postgres
+	var limiter ratelimit.Limiter = ratelimit.NewMemoryLimiter()
+	if cfg.RateLimit.Store == "postgres" {
+		limiter = storage.NewPostgresLimiter(db)
+	}
+
 	// Initialize validator
 	validator := validation.NewNotificationValidator()
 
-	server := api.NewServer(db, q, cfg, validator)
-	server.Start()
+	server := api.NewServer(db, q, cfg, validator, broker, limiter)
+	if err := server.Start(ctx); err != nil {
+		log.Printf("Error running API server: %v", err)
+	}
+
+	// Let the relay finish its batch before the queue and the database are closed
+	stop()
+	background.Wait()
+	log.Printf("API server stopped")
 }
@@ -1,14 +1,22 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"notification-system/pkg/config"
 	"notification-system/pkg/model"
 	"notification-system/pkg/providers"
 	"notification-system/pkg/queue"
+	"notification-system/pkg/ratelimit"
 	"notification-system/pkg/storage"
+	"notification-system/pkg/webhooks"
 	"notification-system/pkg/worker"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 )
 
 func main() {
@@ -18,6 +26,14 @@ func main() {
 		log.Fatalf("Error loading configuration: %v", err)
 	}
 
+	// Shut down on SIGINT or SIGTERM, a second signal kills the process right away
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
 	db, err := storage.NewDatabase(cfg.Database)
 	if err != nil {
 		log.Fatalf("Error initializing database: %v", err)
@@ -53,14 +69,40 @@ func main() {
 	notifier.RegisterStrategy(model.ChannelSMS, smsProvider)
 	notifier.RegisterStrategy(model.ChannelSlack, slackProvider)
 	notifier.RegisterStrategy(model.ChannelEmail, emailProvider)
+
+	// Provider throughput limits are kept per worker unless they are shared through Postgres
+	var limiter ratelimit.Limiter = ratelimit.NewMemoryLimiter()
+	var semaphore ratelimit.Semaphore = ratelimit.NewMemorySemaphore()
+	if cfg.RateLimit.Store == "postgres" {
+		limiter = storage.NewPostgresLimiter(db)
+		semaphore = storage.NewPostgresSemaphore(db)
+	}
+	notifier.SetThrottle(providers.NewThrottle(limiter, semaphore, cfg.RateLimit.Providers))
 	
+	// Deliver the status events of notifications to their callback URLs
+	var background sync.WaitGroup
+	dispatcher := webhooks.NewDispatcher(db, cfg.Webhooks)
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		dispatcher.Start(ctx)
+	}()
+
 	w := worker.NewWorker(
 		db,
 		q,
 		notifier,
 		cfg.Retry,
+		cfg.Consumers,
 		cfg.RabbitMQ.DLQPrefix,
+		time.Duration(cfg.ShutdownTimeout)*time.Second,
 	)
 	
-	w.Start()
+	if err := w.Start(ctx); err != nil {
+		log.Fatalf("Error starting worker: %v", err)
+	}
+
+	// Let the dispatcher finish its batch before the queue and the database are closed
+	stop()
+	background.Wait()
 }
\ No newline at end of file
@@ -1,3 +1,53 @@
+CREATE TABLE api_keys (
+  id UUID PRIMARY KEY,
+  client_id TEXT NOT NULL,
+  name TEXT NOT NULL DEFAULT '',
+  key_hash TEXT NOT NULL UNIQUE,
+  key_prefix TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT now(),
+  expires_at TIMESTAMPTZ,
+  revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX api_keys_client_id_idx ON api_keys (client_id);
+
+CREATE TABLE templates (
+  id UUID PRIMARY KEY,
+  name TEXT NOT NULL,
+  locale TEXT NOT NULL,
+  version INT NOT NULL,
+  published_at TIMESTAMP,
+  sms_body TEXT NOT NULL DEFAULT '',
+  email_subject TEXT NOT NULL DEFAULT '',
+  email_text TEXT NOT NULL DEFAULT '',
+  email_html TEXT NOT NULL DEFAULT '',
+  slack_text TEXT NOT NULL DEFAULT '',
+  slack_blocks TEXT,
+  created_at TIMESTAMP NOT NULL DEFAULT now(),
+  updated_at TIMESTAMP NOT NULL DEFAULT now(),
+  CONSTRAINT templates_name_locale_version_key UNIQUE (name, locale, version)
+);
+
+CREATE TABLE recipients (
+  id TEXT PRIMARY KEY,
+  email TEXT,
+  phone TEXT,
+  slack_channel TEXT,
+  preferences TEXT[] NOT NULL DEFAULT '{}',
+  time_zone TEXT,
+  quiet_hours JSONB,
+  created_at TIMESTAMP NOT NULL DEFAULT now(),
+  updated_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE TABLE messages (
+  id UUID PRIMARY KEY,
+  message TEXT NOT NULL,
+  metadata JSONB,
+  client_id TEXT,
+  created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
 CREATE TABLE notifications (
   id UUID PRIMARY KEY,
   channel TEXT NOT NULL,
@@ -8,5 +58,137 @@ CREATE TABLE notifications (
   attempts INT NOT NULL DEFAULT 0,
   last_error TEXT,
   created_at TIMESTAMP NOT NULL DEFAULT now(),
-  last_tried TIMESTAMP
-);
\ No newline at end of file
+  last_tried TIMESTAMP,
+  idempotency_key TEXT,
+  send_at TIMESTAMPTZ,
+  message_id UUID REFERENCES messages(id),
+  fallback JSONB,
+  fallback_for UUID REFERENCES notifications(id),
+  template_id UUID,
+  -- The template variables, kept to render the template again for the channels of the fallback chain
+  template_variables JSONB,
+  user_id TEXT,
+  priority TEXT NOT NULL DEFAULT 'normal',
+  provider_message_id TEXT,
+  callback_url TEXT,
+  client_id TEXT
+);
+
+-- Idempotency keys are unique per client, notifications created with the admin key have no client
+CREATE UNIQUE INDEX notifications_idempotency_key_key ON notifications ((COALESCE(client_id, '')), idempotency_key);
+CREATE INDEX notifications_client_id_idx ON notifications (client_id);
+
+CREATE INDEX notifications_message_id_idx ON notifications (message_id);
+CREATE INDEX notifications_provider_message_id_idx ON notifications (provider_message_id);
+
+-- Publish status changes of notifications to the API instances streaming them
+CREATE FUNCTION notify_notification_status() RETURNS trigger AS $$
+BEGIN
+  PERFORM pg_notify('notification_status', json_build_object(
+    'id', NEW.id,
+    'channel', NEW.channel,
+    'status', NEW.status,
+    'attempts', NEW.attempts,
+    'messageId', NEW.message_id,
+    'clientId', NEW.client_id,
+    'changedAt', now()
+  )::text);
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER notifications_status_notify
+AFTER INSERT OR UPDATE OF status ON notifications
+FOR EACH ROW EXECUTE FUNCTION notify_notification_status();
+
+CREATE TABLE notification_attempts (
+  id BIGSERIAL PRIMARY KEY,
+  notification_id UUID NOT NULL REFERENCES notifications(id),
+  attempt INT NOT NULL,
+  provider TEXT NOT NULL,
+  started_at TIMESTAMPTZ NOT NULL,
+  duration_ms BIGINT NOT NULL,
+  error TEXT,
+  provider_message_id TEXT
+);
+
+CREATE INDEX notification_attempts_notification_id_idx ON notification_attempts (notification_id);
+
+CREATE TABLE webhook_events (
+  id BIGSERIAL PRIMARY KEY,
+  notification_id UUID NOT NULL REFERENCES notifications(id),
+  event TEXT NOT NULL,
+  url TEXT NOT NULL,
+  payload JSONB NOT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  delivered_at TIMESTAMPTZ,
+  last_error TEXT,
+  created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX webhook_events_notification_id_idx ON webhook_events (notification_id);
+CREATE INDEX webhook_events_pending_idx ON webhook_events (next_attempt_at) WHERE delivered_at IS NULL;
+
+CREATE TABLE webhook_attempts (
+  id BIGSERIAL PRIMARY KEY,
+  event_id BIGINT NOT NULL REFERENCES webhook_events(id),
+  attempted_at TIMESTAMPTZ NOT NULL,
+  duration_ms BIGINT NOT NULL,
+  status_code INT,
+  error TEXT
+);
+
+CREATE INDEX webhook_attempts_event_id_idx ON webhook_attempts (event_id);
+
+CREATE TABLE outbox (
+  id BIGSERIAL PRIMARY KEY,
+  notification_id UUID NOT NULL REFERENCES notifications(id),
+  created_at TIMESTAMP NOT NULL DEFAULT now(),
+  available_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  dispatched_at TIMESTAMP
+);
+
+CREATE INDEX outbox_undispatched_idx ON outbox (available_at) WHERE dispatched_at IS NULL;
+
+CREATE TABLE suppressions (
+  id UUID PRIMARY KEY,
+  channel TEXT NOT NULL,
+  recipient TEXT NOT NULL,
+  category TEXT,
+  reason TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX suppressions_channel_recipient_category_key ON suppressions (channel, lower(recipient), COALESCE(category, ''));
+
+-- The rate and burst of the last limit applied to a bucket tell when it is full again, full buckets
+-- are deleted and recreated on demand
+CREATE TABLE rate_limits (
+  key TEXT PRIMARY KEY,
+  tokens DOUBLE PRECISION NOT NULL,
+  rate DOUBLE PRECISION NOT NULL,
+  burst INTEGER NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL
+);
+
+-- In-flight slots of the provider throughput limits, a slot is free once it expires
+CREATE TABLE rate_limit_leases (
+  key TEXT NOT NULL,
+  slot INTEGER NOT NULL,
+  holder UUID,
+  expires_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (key, slot)
+);
+
+CREATE TABLE rate_limit_rejections (
+  id BIGSERIAL PRIMARY KEY,
+  client_id TEXT,
+  limit_type TEXT NOT NULL,
+  key TEXT NOT NULL,
+  channel TEXT,
+  retry_after_ms BIGINT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX rate_limit_rejections_created_at_idx ON rate_limit_rejections (created_at);
@@ -2,12 +2,16 @@ package api
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"notification-system/pkg/config"
 	"notification-system/pkg/model"
 	"notification-system/pkg/queue"
+	"notification-system/pkg/ratelimit"
 	"notification-system/pkg/storage"
+	"notification-system/pkg/stream"
 	"notification-system/pkg/validation"
 	"time"
 
@@ -15,69 +19,315 @@ import (
 	"github.com/google/uuid"
 )
 
+const (
+	idempotencyKeyHeader    = "Idempotency-Key"
+	maxIdempotencyKeyLength = 255
+
+	// defaultShutdownTimeout is how long requests in progress get to finish on shutdown
+	defaultShutdownTimeout = 30 * time.Second
+)
+
 type Server struct {
-	db       *storage.Database
-	queue    *queue.QueueClient
-	cfg      *config.Config
+	db        *storage.Database
+	queue     *queue.QueueClient
+	cfg       *config.Config
 	validator validation.Validator
+	broker    *stream.Broker
+	limiter   ratelimit.Limiter
+	receipts  *unknownReceipts
 }
 
-func NewServer(db *storage.Database, q *queue.QueueClient, cfg *config.Config, validator validation.Validator) *Server {
+func NewServer(db *storage.Database, q *queue.QueueClient, cfg *config.Config, validator validation.Validator, broker *stream.Broker, limiter ratelimit.Limiter) *Server {
 	return &Server{
-		db:       db,
-		queue:    q,
-		cfg:      cfg,
+		db:        db,
+		queue:     q,
+		cfg:       cfg,
 		validator: validator,
+		broker:    broker,
+		limiter:   limiter,
+		receipts:  newUnknownReceipts(),
 	}
 }
 
-func (s *Server) Start() {
+// Start serves the API until the context is done, then stops accepting connections and waits for
+// the requests in progress to finish
+func (s *Server) Start(ctx context.Context) error {
 	r := gin.Default()
 
-	r.POST("/notifications", func(c *gin.Context) {
-		var notification model.Notification
-		if err := c.ShouldBindJSON(&notification); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
-			return
+	// The provider callbacks are verified by their signatures instead of an API key
+	r.POST("/webhooks/twilio", s.twilioStatusCallback)
+	r.POST("/webhooks/sendgrid", s.sendgridEventWebhook)
+
+	api := r.Group("/", s.authenticate, s.limitClient)
+
+	api.POST("/notifications", s.createNotification)
+	api.POST("/notifications/batch", s.createNotificationBatch)
+	api.GET("/notifications/stream", s.streamNotifications)
+	api.GET("/notifications/:id/status", s.getNotificationStatus)
+	api.GET("/notifications/:id/attempts", s.getNotificationAttempts)
+	api.GET("/notifications/:id/webhooks", s.getNotificationWebhooks)
+	api.DELETE("/notifications/:id", s.cancelNotification)
+
+	api.POST("/messages", s.createMessage)
+	api.GET("/messages/:id", s.getMessage)
+
+	// Templates, recipients and suppressions are shared by all clients, so only the admin manages them
+	admin := api.Group("/", requireAdmin)
+
+	admin.POST("/templates", s.createTemplate)
+	admin.GET("/templates", s.listTemplates)
+	admin.GET("/templates/:id", s.getTemplate)
+	admin.PUT("/templates/:id", s.updateTemplate)
+	admin.POST("/templates/:id/publish", s.publishTemplate)
+	admin.DELETE("/templates/:id", s.deleteTemplate)
+
+	admin.POST("/recipients", s.createRecipient)
+	admin.GET("/recipients/:id", s.getRecipient)
+	admin.PUT("/recipients/:id", s.updateRecipient)
+	admin.DELETE("/recipients/:id", s.deleteRecipient)
+
+	admin.POST("/suppressions", s.createSuppression)
+	admin.GET("/suppressions", s.listSuppressions)
+	admin.DELETE("/suppressions/:id", s.deleteSuppression)
+
+	admin.POST("/api-keys", s.issueAPIKey)
+	admin.GET("/api-keys", s.listAPIKeys)
+	admin.POST("/api-keys/:id/rotate", s.rotateAPIKey)
+	admin.DELETE("/api-keys/:id", s.revokeAPIKey)
+
+	admin.GET("/dlq/:channel", s.listDLQ)
+	admin.POST("/dlq/:channel/replay", s.replayDLQ)
+	admin.POST("/dlq/:channel/purge", s.purgeDLQ)
+
+	srv := &http.Server{
+		Addr:    fmt.Sprintf("%s:%s", s.cfg.Server.Host, s.cfg.Server.Port),
+		Handler: r,
+	}
+	// Status streams never finish on their own, closing the broker ends them
+	srv.RegisterOnShutdown(func() {
+		if err := s.broker.Close(); err != nil {
+			log.Printf("Failed to close status stream broker: %v", err)
 		}
+	})
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
 
-		if err := s.validator.Validate(&notification); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid notification: %v", err)})
+	select {
+	case err := <-errs:
+		return fmt.Errorf("failed to serve API: %w", err)
+	case <-ctx.Done():
+	}
+
+	timeout := time.Duration(s.cfg.ShutdownTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	log.Printf("Shutting down API server, waiting up to %s for requests in progress", timeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down API server: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) createNotification(c *gin.Context) {
+	var notification model.Notification
+	if err := c.ShouldBindJSON(&notification); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	notification.ClientID = requestClientID(c)
+
+	// The header takes precedence over the idempotencyKey field in the body
+	if key := c.GetHeader(idempotencyKeyHeader); key != "" {
+		notification.IdempotencyKey = &key
+	}
+	if err := validateIdempotencyKey(notification.IdempotencyKey); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	if err := s.resolveRecipient(ctx, &notification, nil); err != nil {
+		if errors.Is(err, errRecipientLookup) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load recipient"})
 			return
 		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid recipient: %v", err)})
+		return
+	}
 
-		ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
-		defer cancel()
-
-		notification.ID = uuid.New().String()
-		notification.Status = model.StatusPending
-		notification.CreatedAt = time.Now()
+	// Render the template first, so the validation applies to the rendered message
+	if err := s.applyTemplate(ctx, &notification, nil); err != nil {
+		if errors.Is(err, errTemplateLookup) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load template"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid template: %v", err)})
+		return
+	}
 
-		if err := s.db.SaveNotification(ctx, notification); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save notification"})
+	if err := s.validate(ctx, &notification, nil); err != nil {
+		if errors.Is(err, errTemplateLookup) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load template"})
 			return
 		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid notification: %v", err)})
+		return
+	}
 
-		if err := s.queue.Publish(notification); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue message"})
+	if notification.IdempotencyKey != nil {
+		existing, err := s.db.GetNotificationByIdempotencyKey(ctx, notification.ClientID, *notification.IdempotencyKey, s.idempotencyWindow())
+		if err == nil {
+			c.JSON(http.StatusOK, gin.H{"id": existing.ID, "status": existing.Status})
+			return
+		}
+		if !errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check idempotency key"})
 			return
 		}
+	}
 
-		c.JSON(http.StatusAccepted, gin.H{"id": notification.ID, "status": notification.Status})
-	})
+	prepareNotification(&notification)
 
-	r.GET("/notifications/:id/status", func(c *gin.Context) {
-		ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
-		defer cancel()
+	if err := s.markSuppressed(ctx, []*model.Notification{&notification}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check suppressions"})
+		return
+	}
 
-		id := c.Param("id")
-		notification, err := s.db.GetNotificationByID(ctx, id)
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
-			return
+	if wait, ok := s.limitRecipient(ctx, &notification); !ok {
+		rejectRateLimited(c, wait, "Rate limit exceeded for recipient")
+		return
+	}
+
+	if err := s.db.SaveNotification(ctx, notification); err != nil {
+		s.refundRecipients(&notification)
+		if errors.Is(err, storage.ErrDuplicateIdempotencyKey) {
+			// A concurrent request with the same key won the race
+			existing, err := s.db.GetNotificationByIdempotencyKey(ctx, notification.ClientID, *notification.IdempotencyKey, s.idempotencyWindow())
+			if err == nil {
+				c.JSON(http.StatusOK, gin.H{"id": existing.ID, "status": existing.Status})
+				return
+			}
 		}
-		c.JSON(http.StatusOK, notification)
-	})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save notification"})
+		return
+	}
+
+	if notification.Status == model.StatusScheduled {
+		c.JSON(http.StatusAccepted, gin.H{"id": notification.ID, "status": notification.Status, "sendAt": notification.SendAt})
+		return
+	}
+	if notification.Status == model.StatusSuppressed {
+		c.JSON(http.StatusAccepted, gin.H{"id": notification.ID, "status": notification.Status})
+		return
+	}
+
+	s.dispatchBatch(ctx, []model.Notification{notification})
+
+	c.JSON(http.StatusAccepted, gin.H{"id": notification.ID, "status": notification.Status})
+}
+
+func (s *Server) getNotificationStatus(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	notification, ok := s.ownNotification(ctx, c, c.Param("id"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, notification)
+}
+
+func (s *Server) getNotificationAttempts(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	id := c.Param("id")
+	if _, ok := s.ownNotification(ctx, c, id); !ok {
+		return
+	}
+
+	attempts, err := s.db.ListAttempts(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get attempts"})
+		return
+	}
+	c.JSON(http.StatusOK, attempts)
+}
+
+// getNotificationWebhooks lists the status events posted to the callback URL of a notification
+// with their delivery attempts
+func (s *Server) getNotificationWebhooks(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
 
-	r.Run(fmt.Sprintf("%s:%s", s.cfg.Server.Host, s.cfg.Server.Port))
-}
\ No newline at end of file
+	id := c.Param("id")
+	if _, ok := s.ownNotification(ctx, c, id); !ok {
+		return
+	}
+
+	events, err := s.db.ListWebhookEvents(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get webhook events"})
+		return
+	}
+	c.JSON(http.StatusOK, events)
+}
+
+func (s *Server) cancelNotification(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	if _, ok := s.ownNotification(ctx, c, c.Param("id")); !ok {
+		return
+	}
+
+	notification, err := s.db.CancelNotification(ctx, c.Param("id"))
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+	case errors.Is(err, storage.ErrNotCancellable):
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Notification with status %s cannot be cancelled", notification.Status)})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel notification"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"id": notification.ID, "status": notification.Status})
+	}
+}
+
+// prepareNotification assigns the ID, creation time and initial status of a new notification
+func prepareNotification(notification *model.Notification) {
+	notification.ID = uuid.New().String()
+	notification.Status = model.StatusPending
+	notification.CreatedAt = time.Now()
+	if notification.Priority == "" {
+		notification.Priority = model.PriorityNormal
+	}
+
+	// Notifications due in the future are held in the outbox until sendAt, the rest are sent right away
+	if notification.SendAt != nil && !notification.SendAt.After(notification.CreatedAt) {
+		notification.SendAt = nil
+	}
+	if notification.SendAt != nil {
+		notification.Status = model.StatusScheduled
+	}
+}
+
+func validateIdempotencyKey(key *string) error {
+	if key != nil && len(*key) > maxIdempotencyKeyLength {
+		return fmt.Errorf("idempotency key exceeds %d characters", maxIdempotencyKeyLength)
+	}
+	return nil
+}
+
+func (s *Server) idempotencyWindow() time.Duration {
+	return time.Duration(s.cfg.Server.IdempotencyWindow) * time.Minute
+}
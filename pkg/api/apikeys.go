@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"notification-system/pkg/auth"
+	"notification-system/pkg/model"
+	"notification-system/pkg/storage"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxClientIDLength limits client IDs to a sensible size for logs and lookups
+const maxClientIDLength = 255
+
+// apiKeyRequest issues a key for a client, the name tells keys of the same client apart
+type apiKeyRequest struct {
+	ClientID string `json:"clientId"`
+	Name     string `json:"name"`
+}
+
+// rotateRequest sets how long the replaced key keeps working
+type rotateRequest struct {
+	GracePeriodMinutes int `json:"gracePeriodMinutes"`
+}
+
+func (s *Server) issueAPIKey(c *gin.Context) {
+	var request apiKeyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if request.ClientID == "" || len(request.ClientID) > maxClientIDLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "clientId must be between 1 and 255 characters"})
+		return
+	}
+
+	apiKey, keyHash, err := newAPIKey()
+	if err != nil {
+		log.Printf("Failed to generate API key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+		return
+	}
+	apiKey.ClientID = request.ClientID
+	apiKey.Name = request.Name
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	if err := s.db.CreateAPIKey(ctx, apiKey, keyHash); err != nil {
+		log.Printf("Failed to create API key for client %s: %v", apiKey.ClientID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+	c.JSON(http.StatusCreated, apiKey)
+}
+
+// listAPIKeys lists the API keys without the keys themselves, optionally of a single client
+func (s *Server) listAPIKeys(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	keys, err := s.db.ListAPIKeys(ctx, c.Query("clientId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list API keys"})
+		return
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+func (s *Server) revokeAPIKey(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	apiKey, err := s.db.RevokeAPIKey(ctx, c.Param("id"))
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+	c.JSON(http.StatusOK, apiKey)
+}
+
+// rotateAPIKey issues a new key for the client of an existing one, which expires after the grace period
+func (s *Server) rotateAPIKey(c *gin.Context) {
+	var request rotateRequest
+	// The body is optional, without it the old key stops working right away
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+	}
+	if request.GracePeriodMinutes < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "gracePeriodMinutes cannot be negative"})
+		return
+	}
+
+	apiKey, keyHash, err := newAPIKey()
+	if err != nil {
+		log.Printf("Failed to generate API key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	grace := time.Duration(request.GracePeriodMinutes) * time.Minute
+	err = s.db.RotateAPIKey(ctx, c.Param("id"), &apiKey, keyHash, grace)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to rotate API key %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate API key"})
+		return
+	}
+	c.JSON(http.StatusCreated, apiKey)
+}
+
+// newAPIKey generates a key and returns it together with its hash. The key is only part of the
+// response, it is never stored.
+func newAPIKey() (model.APIKey, string, error) {
+	key, prefix, err := auth.GenerateKey()
+	if err != nil {
+		return model.APIKey{}, "", err
+	}
+	return model.APIKey{
+		ID:        uuid.New().String(),
+		Prefix:    prefix,
+		CreatedAt: time.Now(),
+		Key:       key,
+	}, auth.HashKey(key), nil
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"notification-system/pkg/auth"
+	"notification-system/pkg/model"
+	"notification-system/pkg/storage"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	apiKeyHeader = "X-API-Key"
+
+	// Keys of the caller identity in the gin context
+	clientIDContextKey = "clientID"
+	adminContextKey    = "admin"
+)
+
+// authenticate identifies the caller by the X-API-Key header, which holds either the admin key or
+// a key issued to a client
+func (s *Server) authenticate(c *gin.Context) {
+	key := c.GetHeader(apiKeyHeader)
+	if key == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing API key"})
+		return
+	}
+
+	if s.cfg.Server.AdminAPIKey != "" && auth.Matches(key, s.cfg.Server.AdminAPIKey) {
+		c.Set(adminContextKey, true)
+		c.Next()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	apiKey, err := s.db.GetAPIKeyByHash(ctx, auth.HashKey(key))
+	if errors.Is(err, storage.ErrNotFound) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to look up API key: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check API key"})
+		return
+	}
+
+	c.Set(clientIDContextKey, apiKey.ClientID)
+	c.Next()
+}
+
+// requireAdmin only lets requests made with the admin key through
+func requireAdmin(c *gin.Context) {
+	if !isAdmin(c) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin API key required"})
+		return
+	}
+	c.Next()
+}
+
+func isAdmin(c *gin.Context) bool {
+	return c.GetBool(adminContextKey)
+}
+
+// requestClientID returns the client making the request, nil for the admin
+func requestClientID(c *gin.Context) *string {
+	clientID := c.GetString(clientIDContextKey)
+	if clientID == "" {
+		return nil
+	}
+	return &clientID
+}
+
+// ownedBy reports whether the caller may see a resource of the given client. The admin sees the
+// resources of all clients.
+func ownedBy(c *gin.Context, clientID *string) bool {
+	if isAdmin(c) {
+		return true
+	}
+	caller := requestClientID(c)
+	return caller != nil && clientID != nil && *caller == *clientID
+}
+
+// ownNotification loads a notification of the caller, responding with 404 when it does not exist
+// or belongs to another client, so the IDs of other clients are not revealed
+func (s *Server) ownNotification(ctx context.Context, c *gin.Context, id string) (*model.Notification, bool) {
+	notification, err := s.db.GetNotificationByID(ctx, id)
+	if err != nil || !ownedBy(c, notification.ClientID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return nil, false
+	}
+	return notification, true
+}
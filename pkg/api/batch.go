@@ -0,0 +1,209 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"notification-system/pkg/model"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// batchItemResult is the outcome of a single notification in a batch request
+type batchItemResult struct {
+	Index  int                      `json:"index"`
+	ID     string                   `json:"id,omitempty"`
+	Status model.NotificationStatus `json:"status,omitempty"`
+	Error  string                   `json:"error,omitempty"`
+	// RetryAfter is set in seconds when the recipient was rate limited
+	RetryAfter int `json:"retryAfter,omitempty"`
+}
+
+func (s *Server) createNotificationBatch(c *gin.Context) {
+	var notifications []model.Notification
+	if err := c.ShouldBindJSON(&notifications); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if len(notifications) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Batch cannot be empty"})
+		return
+	}
+	if s.cfg.Server.MaxBatchSize > 0 && len(notifications) > s.cfg.Server.MaxBatchSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Batch exceeds %d notifications", s.cfg.Server.MaxBatchSize)})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	templates := make(map[string]*model.Template)
+	recipients := make(map[string]*model.Recipient)
+	results := make([]batchItemResult, len(notifications))
+	// Indexes of the valid notifications, and the idempotency keys among them
+	var valid []int
+	var keys []string
+	for i := range notifications {
+		notification := &notifications[i]
+		notification.ClientID = requestClientID(c)
+		results[i].Index = i
+
+		if err := validateIdempotencyKey(notification.IdempotencyKey); err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		if err := s.resolveRecipient(ctx, notification, recipients); err != nil {
+			if errors.Is(err, errRecipientLookup) {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load recipient"})
+				return
+			}
+			results[i].Error = fmt.Sprintf("Invalid recipient: %v", err)
+			continue
+		}
+		if err := s.applyTemplate(ctx, notification, templates); err != nil {
+			if errors.Is(err, errTemplateLookup) {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load template"})
+				return
+			}
+			results[i].Error = fmt.Sprintf("Invalid template: %v", err)
+			continue
+		}
+		if err := s.validate(ctx, notification, templates); err != nil {
+			if errors.Is(err, errTemplateLookup) {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load template"})
+				return
+			}
+			results[i].Error = fmt.Sprintf("Invalid notification: %v", err)
+			continue
+		}
+
+		valid = append(valid, i)
+		if notification.IdempotencyKey != nil {
+			keys = append(keys, *notification.IdempotencyKey)
+		}
+	}
+
+	// All idempotency keys of the batch are looked up at once
+	existing, err := s.db.GetNotificationsByIdempotencyKeys(ctx, requestClientID(c), keys, s.idempotencyWindow())
+	if err != nil {
+		log.Printf("Failed to check idempotency keys of notification batch: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check idempotency keys"})
+		return
+	}
+
+	// Indexes of the new notifications, already known ones are left out
+	var prepared []int
+	for _, i := range valid {
+		notification := &notifications[i]
+		if notification.IdempotencyKey != nil {
+			if known, ok := existing[*notification.IdempotencyKey]; ok {
+				results[i].ID, results[i].Status = known.ID, known.Status
+				continue
+			}
+		}
+
+		prepareNotification(notification)
+		prepared = append(prepared, i)
+	}
+
+	toCheck := make([]*model.Notification, 0, len(prepared))
+	for _, i := range prepared {
+		toCheck = append(toCheck, &notifications[i])
+	}
+	if err := s.markSuppressed(ctx, toCheck); err != nil {
+		log.Printf("Failed to check suppressions for notification batch: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check suppressions"})
+		return
+	}
+
+	// Indexes of the notifications to store, the ones over the limit of their recipient are left out
+	var accepted []int
+	var limited []*model.Notification
+	for _, i := range prepared {
+		if wait, ok := s.limitRecipient(ctx, &notifications[i]); !ok {
+			results[i].Error = "Rate limit exceeded for recipient"
+			results[i].RetryAfter = retryAfterSeconds(wait)
+			continue
+		}
+		accepted = append(accepted, i)
+		limited = append(limited, &notifications[i])
+	}
+
+	toSave := make([]model.Notification, 0, len(accepted))
+	for _, i := range accepted {
+		toSave = append(toSave, notifications[i])
+	}
+
+	saved, err := s.db.SaveNotifications(ctx, toSave)
+	if err != nil {
+		s.refundRecipients(limited...)
+		log.Printf("Failed to save notification batch: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save notifications"})
+		return
+	}
+
+	// The idempotency keys lost to a concurrent request or an earlier item of this batch
+	var lost []string
+	var unsaved []*model.Notification
+	for _, i := range accepted {
+		if !saved[notifications[i].ID] {
+			lost = append(lost, *notifications[i].IdempotencyKey)
+			unsaved = append(unsaved, &notifications[i])
+		}
+	}
+	s.refundRecipients(unsaved...)
+	winners, err := s.db.GetNotificationsByIdempotencyKeys(ctx, requestClientID(c), lost, s.idempotencyWindow())
+	if err != nil {
+		log.Printf("Failed to get notifications of lost idempotency keys: %v", err)
+	}
+
+	var toPublish []model.Notification
+	for _, i := range accepted {
+		notification := notifications[i]
+		if !saved[notification.ID] {
+			winner, ok := winners[*notification.IdempotencyKey]
+			if !ok {
+				results[i].Error = "Failed to save notification"
+				continue
+			}
+			results[i].ID, results[i].Status = winner.ID, winner.Status
+			continue
+		}
+
+		results[i].ID, results[i].Status = notification.ID, notification.Status
+		if notification.Status == model.StatusPending {
+			toPublish = append(toPublish, notification)
+		}
+	}
+
+	s.dispatchBatch(ctx, toPublish)
+
+	c.JSON(http.StatusAccepted, gin.H{"results": results})
+}
+
+// dispatchBatch publishes saved notifications right away. Failures are only logged, since the
+// notifications are already in the outbox and the relay will publish them later.
+func (s *Server) dispatchBatch(ctx context.Context, notifications []model.Notification) {
+	if len(notifications) == 0 {
+		return
+	}
+
+	var published []string
+	for i, err := range s.queue.PublishBatch(notifications) {
+		if err != nil {
+			log.Printf("Failed to publish notification %s, leaving it to the relay: %v", notifications[i].ID, err)
+			continue
+		}
+		published = append(published, notifications[i].ID)
+	}
+
+	if len(published) == 0 {
+		return
+	}
+	if err := s.db.MarkOutboxDispatched(ctx, published...); err != nil {
+		log.Printf("Failed to mark %d notifications as dispatched: %v", len(published), err)
+	}
+}
@@ -0,0 +1,233 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"notification-system/pkg/model"
+	"notification-system/pkg/queue"
+	"notification-system/pkg/storage"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultDLQListLimit is the number of messages listed from a DLQ when no limit is given
+const defaultDLQListLimit = 100
+
+// dlqRequest selects the messages of a DLQ to replay or purge, either by notification ID or all of
+// them. Only the first queue.MaxDLQBatch messages of the DLQ are looked at. Replayed messages
+// selected by ID can get a new recipient.
+type dlqRequest struct {
+	IDs       []string `json:"ids"`
+	All       bool     `json:"all"`
+	Recipient string   `json:"recipient"`
+}
+
+// dlqResult lists the notifications a DLQ request was applied to and the ones it failed for
+type dlqResult struct {
+	Processed []string          `json:"processed"`
+	Failed    map[string]string `json:"failed,omitempty"`
+}
+
+func (s *Server) listDLQ(c *gin.Context) {
+	channel, ok := s.dlqChannel(c)
+	if !ok {
+		return
+	}
+
+	limit := defaultDLQListLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > queue.MaxDLQBatch {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Limit must be between 1 and %d", queue.MaxDLQBatch)})
+			return
+		}
+		limit = parsed
+	}
+
+	var dead []model.Notification
+	err := s.queue.ProcessDLQ(channel, limit, func(notification model.Notification) queue.DLQAction {
+		dead = append(dead, notification)
+		return queue.DLQKeep
+	})
+	if err != nil {
+		log.Printf("Failed to read DLQ of channel %s: %v", channel, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read DLQ"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	ids := make([]string, len(dead))
+	for i, notification := range dead {
+		ids[i] = notification.ID
+	}
+	stored, err := s.db.GetNotificationsByIDs(ctx, ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get notifications"})
+		return
+	}
+
+	// The stored notifications hold the last error and the number of attempts
+	notifications := make([]model.Notification, len(dead))
+	for i, notification := range dead {
+		if n, ok := stored[notification.ID]; ok {
+			notification = n
+		}
+		notifications[i] = notification
+	}
+	c.JSON(http.StatusOK, notifications)
+}
+
+// replayDLQ moves the selected messages of a DLQ back to pending and publishes them again. They
+// counted against the recipient limit when they were created, so they are not limited again.
+func (s *Server) replayDLQ(c *gin.Context) {
+	channel, ok := s.dlqChannel(c)
+	if !ok {
+		return
+	}
+	request, ok := bindDLQRequest(c)
+	if !ok {
+		return
+	}
+	if request.Recipient != "" && len(request.IDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A new recipient can only be set for selected messages"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	result := dlqResult{Processed: []string{}, Failed: make(map[string]string)}
+	var replayed []model.Notification
+	err := s.queue.ProcessDLQ(channel, queue.MaxDLQBatch, func(notification model.Notification) queue.DLQAction {
+		if !request.selects(notification.ID) {
+			return queue.DLQKeep
+		}
+
+		if request.Recipient != "" {
+			notification.Recipient = request.Recipient
+			if err := s.validator.Validate(&notification); err != nil {
+				result.Failed[notification.ID] = fmt.Sprintf("Invalid notification: %v", err)
+				return queue.DLQKeep
+			}
+		}
+
+		notification.Status = model.StatusPending
+		if err := s.db.ReplayNotification(ctx, notification); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				result.Failed[notification.ID] = "Notification not found"
+			} else {
+				result.Failed[notification.ID] = "Failed to save notification"
+			}
+			return queue.DLQKeep
+		}
+
+		result.Processed = append(result.Processed, notification.ID)
+		replayed = append(replayed, notification)
+		return queue.DLQRemove
+	})
+	if err != nil {
+		log.Printf("Failed to replay DLQ of channel %s: %v", channel, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to replay DLQ"})
+		return
+	}
+	request.reportMissing(&result)
+
+	// The replayed notifications are in the outbox, so the relay publishes the ones that fail here
+	s.dispatchBatch(ctx, replayed)
+
+	c.JSON(http.StatusOK, result)
+}
+
+// purgeDLQ removes the selected messages from a DLQ and marks their notifications as failed for good
+func (s *Server) purgeDLQ(c *gin.Context) {
+	channel, ok := s.dlqChannel(c)
+	if !ok {
+		return
+	}
+	request, ok := bindDLQRequest(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	result := dlqResult{Processed: []string{}, Failed: make(map[string]string)}
+	err := s.queue.ProcessDLQ(channel, queue.MaxDLQBatch, func(notification model.Notification) queue.DLQAction {
+		if !request.selects(notification.ID) {
+			return queue.DLQKeep
+		}
+
+		if err := s.db.SetNotificationStatus(ctx, notification.ID, model.StatusFailed); err != nil {
+			result.Failed[notification.ID] = "Failed to update notification"
+			return queue.DLQKeep
+		}
+
+		result.Processed = append(result.Processed, notification.ID)
+		return queue.DLQRemove
+	})
+	if err != nil {
+		log.Printf("Failed to purge DLQ of channel %s: %v", channel, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge DLQ"})
+		return
+	}
+	request.reportMissing(&result)
+
+	c.JSON(http.StatusOK, result)
+}
+
+// dlqChannel returns the channel of a DLQ request, responding with 404 when it has no queue
+func (s *Server) dlqChannel(c *gin.Context) (model.NotificationChannel, bool) {
+	channel := model.NotificationChannel(c.Param("channel"))
+	if _, ok := s.cfg.RabbitMQ.ChannelQueues[channel]; !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Unknown channel %s", channel)})
+		return "", false
+	}
+	return channel, true
+}
+
+func bindDLQRequest(c *gin.Context) (dlqRequest, bool) {
+	var request dlqRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return request, false
+	}
+	if request.All == (len(request.IDs) > 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Either ids or all must be given"})
+		return request, false
+	}
+	return request, true
+}
+
+// selects reports whether the request applies to the notification with the given ID
+func (r dlqRequest) selects(id string) bool {
+	if r.All {
+		return true
+	}
+	for _, selected := range r.IDs {
+		if selected == id {
+			return true
+		}
+	}
+	return false
+}
+
+// reportMissing adds the selected notifications that were not found in the DLQ to the failures
+func (r dlqRequest) reportMissing(result *dlqResult) {
+	processed := make(map[string]bool, len(result.Processed))
+	for _, id := range result.Processed {
+		processed[id] = true
+	}
+	for _, id := range r.IDs {
+		if _, failed := result.Failed[id]; !failed && !processed[id] {
+			result.Failed[id] = fmt.Sprintf("Not found in the first %d messages of the DLQ", queue.MaxDLQBatch)
+		}
+	}
+}
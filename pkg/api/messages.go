@@ -0,0 +1,215 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"notification-system/pkg/model"
+	"notification-system/pkg/storage"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func (s *Server) createMessage(c *gin.Context) {
+	var message model.Message
+	if err := c.ShouldBindJSON(&message); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if len(message.Targets) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one target is required"})
+		return
+	}
+
+	message.ID = uuid.New().String()
+	message.CreatedAt = time.Now()
+	message.ClientID = requestClientID(c)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	// Create a child notification per target, the message is only accepted if all of them are valid
+	templates := make(map[string]*model.Template)
+	recipients := make(map[string]*model.Recipient)
+	notifications := make([]model.Notification, 0, len(message.Targets))
+	for i, target := range message.Targets {
+		notification := model.Notification{
+			Channel:         target.Channel,
+			Recipient:       target.Recipient,
+			Message:         message.Message,
+			Metadata:        message.Metadata,
+			SendAt:          message.SendAt,
+			MessageID:       &message.ID,
+			TemplateID:      message.TemplateID,
+			TemplateName:    message.TemplateName,
+			TemplateVersion: message.TemplateVersion,
+			Locale:          message.Locale,
+			Variables:       message.Variables,
+			UserID:          target.UserID,
+			Priority:        message.Priority,
+			CallbackURL:     message.CallbackURL,
+			ClientID:        message.ClientID,
+		}
+		if err := s.resolveRecipient(ctx, &notification, recipients); err != nil {
+			if errors.Is(err, errRecipientLookup) {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load recipient"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid recipient for target %d: %v", i, err)})
+			return
+		}
+		if err := s.applyTemplate(ctx, &notification, templates); err != nil {
+			if errors.Is(err, errTemplateLookup) {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load template"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid template for target %d: %v", i, err)})
+			return
+		}
+		if err := s.validator.Validate(&notification); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid target %d: %v", i, err)})
+			return
+		}
+
+		prepareNotification(&notification)
+		notifications = append(notifications, notification)
+	}
+
+	toCheck := make([]*model.Notification, len(notifications))
+	for i := range notifications {
+		toCheck[i] = &notifications[i]
+	}
+	if err := s.markSuppressed(ctx, toCheck); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check suppressions"})
+		return
+	}
+
+	// The recipients are limited once all targets are valid, so a rejected message takes no tokens
+	for i := range notifications {
+		if wait, ok := s.limitRecipient(ctx, &notifications[i]); !ok {
+			s.refundRecipients(toCheck[:i]...)
+			rejectRateLimited(c, wait, fmt.Sprintf("Rate limit exceeded for the recipient of target %d", i))
+			return
+		}
+	}
+
+	if err := s.db.SaveMessage(ctx, message, notifications); err != nil {
+		s.refundRecipients(toCheck...)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save message"})
+		return
+	}
+
+	var toPublish []model.Notification
+	for _, notification := range notifications {
+		if notification.Status == model.StatusPending {
+			toPublish = append(toPublish, notification)
+		}
+	}
+	s.dispatchBatch(ctx, toPublish)
+
+	message.Notifications = notifications
+	message.Status = aggregateStatus(notifications)
+	c.JSON(http.StatusAccepted, message)
+}
+
+func (s *Server) getMessage(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	message, err := s.db.GetMessageByID(ctx, c.Param("id"))
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && !ownedBy(c, message.ClientID)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get message"})
+		return
+	}
+
+	message.Status = aggregateStatus(message.Notifications)
+	c.JSON(http.StatusOK, message)
+}
+
+// aggregateStatus summarizes the statuses of the notifications of a message. A fallback chain
+// counts as a single notification with the status of its last link. Suppressed and cancelled
+// notifications are left out as long as others were sent. Of the rest, the message is pending while
+// any of them is still in progress, sent or delivered once all of them succeeded, failed, bounced
+// or undelivered once all of them failed, and partial when some succeeded and some failed.
+func aggregateStatus(notifications []model.Notification) model.NotificationStatus {
+	notifications = lastLinks(notifications)
+	if len(notifications) == 0 {
+		return model.StatusPending
+	}
+
+	counts := make(map[model.NotificationStatus]int)
+	skipped := 0
+	for _, notification := range notifications {
+		counts[notification.Status]++
+		if notification.Status == model.StatusSuppressed || notification.Status == model.StatusCancelled {
+			skipped++
+		}
+	}
+
+	// Nothing was sent, the message was cancelled unless all of it was suppressed
+	if skipped == len(notifications) {
+		if counts[model.StatusSuppressed] == len(notifications) {
+			return model.StatusSuppressed
+		}
+		return model.StatusCancelled
+	}
+
+	considered := len(notifications) - skipped
+	succeeded := counts[model.StatusSent] + counts[model.StatusDelivered]
+	switch {
+	case counts[model.StatusScheduled] == considered:
+		return model.StatusScheduled
+	case counts[model.StatusPending] > 0 || counts[model.StatusScheduled] > 0:
+		return model.StatusPending
+	case counts[model.StatusDelivered] == considered:
+		return model.StatusDelivered
+	case succeeded == considered:
+		return model.StatusSent
+	case succeeded > 0:
+		return model.StatusPartial
+	}
+
+	// All of them failed, with a common status if they failed the same way
+	for _, status := range []model.NotificationStatus{model.StatusBounced, model.StatusUndelivered} {
+		if counts[status] == considered {
+			return status
+		}
+	}
+	return model.StatusFailed
+}
+
+// lastLinks replaces every fallback chain among the notifications of a message with its last link
+func lastLinks(notifications []model.Notification) []model.Notification {
+	byID := make(map[string]bool, len(notifications))
+	next := make(map[string]int, len(notifications))
+	for i, notification := range notifications {
+		byID[notification.ID] = true
+		if notification.FallbackFor != nil {
+			next[*notification.FallbackFor] = i
+		}
+	}
+
+	var last []model.Notification
+	for _, notification := range notifications {
+		// Chains are followed from their first link only
+		if notification.FallbackFor != nil && byID[*notification.FallbackFor] {
+			continue
+		}
+		for {
+			i, ok := next[notification.ID]
+			if !ok {
+				break
+			}
+			notification = notifications[i]
+		}
+		last = append(last, notification)
+	}
+	return last
+}
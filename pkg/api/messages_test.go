@@ -0,0 +1,45 @@
+package api
+
+import (
+	"notification-system/pkg/model"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("aggregateStatus", func() {
+	notifications := func(statuses ...model.NotificationStatus) []model.Notification {
+		result := make([]model.Notification, len(statuses))
+		for i, status := range statuses {
+			result[i] = model.Notification{ID: string(rune('a' + i)), Status: status}
+		}
+		return result
+	}
+
+	DescribeTable("should summarize the statuses of the targets",
+		func(statuses []model.NotificationStatus, expected model.NotificationStatus) {
+			Expect(aggregateStatus(notifications(statuses...))).To(Equal(expected))
+		},
+		Entry("all scheduled", []model.NotificationStatus{model.StatusScheduled, model.StatusScheduled}, model.StatusScheduled),
+		Entry("one still in progress", []model.NotificationStatus{model.StatusSent, model.StatusPending}, model.StatusPending),
+		Entry("sent and delivered", []model.NotificationStatus{model.StatusSent, model.StatusDelivered}, model.StatusSent),
+		Entry("all delivered", []model.NotificationStatus{model.StatusDelivered, model.StatusDelivered}, model.StatusDelivered),
+		Entry("some succeeded and some failed", []model.NotificationStatus{model.StatusDelivered, model.StatusBounced}, model.StatusPartial),
+		Entry("all bounced", []model.NotificationStatus{model.StatusBounced, model.StatusBounced}, model.StatusBounced),
+		Entry("failed in different ways", []model.NotificationStatus{model.StatusFailed, model.StatusUndelivered}, model.StatusFailed),
+		Entry("sent besides a suppressed one", []model.NotificationStatus{model.StatusSent, model.StatusSuppressed}, model.StatusSent),
+		Entry("failed besides a cancelled one", []model.NotificationStatus{model.StatusFailed, model.StatusCancelled}, model.StatusFailed),
+		Entry("all suppressed", []model.NotificationStatus{model.StatusSuppressed, model.StatusSuppressed}, model.StatusSuppressed),
+		Entry("suppressed and cancelled", []model.NotificationStatus{model.StatusSuppressed, model.StatusCancelled}, model.StatusCancelled),
+	)
+
+	It("should count a fallback chain with the status of its last link", func() {
+		chain := notifications(model.StatusFailed, model.StatusFailed, model.StatusDelivered)
+		chain[1].FallbackFor = &chain[0].ID
+		chain[2].FallbackFor = &chain[1].ID
+		Expect(aggregateStatus(chain)).To(Equal(model.StatusDelivered))
+
+		chain[2].Status = model.StatusPending
+		Expect(aggregateStatus(chain)).To(Equal(model.StatusPending))
+	})
+})
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"math"
+	"net/http"
+	"notification-system/pkg/model"
+	"notification-system/pkg/ratelimit"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Kinds of rate limits recorded with the rejections
+const (
+	limitTypeClient    = "client"
+	limitTypeRecipient = "recipient"
+)
+
+// limitClient rejects the requests of a client above its request rate. The admin key is not limited.
+func (s *Server) limitClient(c *gin.Context) {
+	clientID := requestClientID(c)
+	limit := s.clientLimit()
+	if clientID == nil || !limit.Enabled() {
+		c.Next()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	key := limitTypeClient + ":" + *clientID
+	allowed, wait, err := s.limiter.Allow(ctx, key, limit, 1)
+	if err != nil {
+		// An unavailable limiter should not take the API down with it
+		log.Printf("Failed to check rate limit of client %s: %v", *clientID, err)
+		c.Next()
+		return
+	}
+	if !allowed {
+		s.recordRejection(ctx, model.RateLimitRejection{
+			ClientID:  clientID,
+			LimitType: limitTypeClient,
+			Key:       key,
+		}, wait)
+		rejectRateLimited(c, wait, "Rate limit exceeded")
+		return
+	}
+	c.Next()
+}
+
+// limitRecipient takes a token from the hourly limit of the recipient of a notification on its
+// channel. The limit applies across all clients, and if it is exceeded it returns false and how
+// long to wait. The token is given back with refundRecipients if the notification is not saved.
+// Suppressed notifications are not sent, so they take no token and must be marked before.
+func (s *Server) limitRecipient(ctx context.Context, notification *model.Notification) (time.Duration, bool) {
+	limit := s.recipientLimit(notification.Channel)
+	if !limit.Enabled() || notification.Status == model.StatusSuppressed {
+		return 0, true
+	}
+
+	key := recipientKey(notification)
+	allowed, wait, err := s.limiter.Allow(ctx, key, limit, 1)
+	if err != nil {
+		log.Printf("Failed to check rate limit of recipient on channel %s: %v", notification.Channel, err)
+		return 0, true
+	}
+	if !allowed {
+		s.recordRejection(ctx, model.RateLimitRejection{
+			ClientID:  notification.ClientID,
+			LimitType: limitTypeRecipient,
+			Key:       key,
+			Channel:   &notification.Channel,
+		}, wait)
+	}
+	return wait, allowed
+}
+
+// refundRecipients gives back the tokens taken by limitRecipient for notifications that were not
+// saved. Failures are only logged, the tokens are refilled over time anyway.
+func (s *Server) refundRecipients(notifications ...*model.Notification) {
+	// The request context may be done already, e.g. when saving timed out
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	for _, notification := range notifications {
+		limit := s.recipientLimit(notification.Channel)
+		if !limit.Enabled() || notification.Status == model.StatusSuppressed {
+			continue
+		}
+		if err := s.limiter.Refund(ctx, recipientKey(notification), limit, 1); err != nil {
+			log.Printf("Failed to refund rate limit of recipient on channel %s: %v", notification.Channel, err)
+		}
+	}
+}
+
+// recipientLimit returns the hourly limit of a recipient on a channel
+func (s *Server) recipientLimit(channel model.NotificationChannel) ratelimit.Limit {
+	return ratelimit.PerHour(s.cfg.RateLimit.RecipientPerHour[channel])
+}
+
+// recipientKey returns the rate limit key of the recipient of a notification. Recipients are
+// matched case-insensitively, like suppressions, and only their hash is stored.
+func recipientKey(notification *model.Notification) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(notification.Recipient)))
+	return limitTypeRecipient + ":" + string(notification.Channel) + ":" + hex.EncodeToString(sum[:])
+}
+
+// clientLimit returns the request rate of a client, the burst defaults to a second worth of requests
+func (s *Server) clientLimit() ratelimit.Limit {
+	limit := ratelimit.Limit{
+		Rate:  s.cfg.RateLimit.ClientRequestsPerSecond,
+		Burst: s.cfg.RateLimit.ClientBurst,
+	}
+	if limit.Burst <= 0 {
+		limit.Burst = int(math.Ceil(limit.Rate))
+	}
+	return limit
+}
+
+// recordRejection stores a rate limited request. Failures are only logged.
+func (s *Server) recordRejection(ctx context.Context, rejection model.RateLimitRejection, wait time.Duration) {
+	rejection.RetryAfterMs = wait.Milliseconds()
+	rejection.CreatedAt = time.Now()
+	if err := s.db.RecordRateLimitRejection(ctx, rejection); err != nil {
+		log.Printf("Failed to record rate limit rejection for %s: %v", rejection.Key, err)
+	}
+}
+
+// rejectRateLimited responds with 429 and the Retry-After header in whole seconds
+func rejectRateLimited(c *gin.Context, wait time.Duration, message string) {
+	c.Header("Retry-After", strconv.Itoa(retryAfterSeconds(wait)))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": message})
+}
+
+// retryAfterSeconds rounds a wait up to whole seconds, as Retry-After has no finer resolution
+func retryAfterSeconds(wait time.Duration) int {
+	return max(int(math.Ceil(wait.Seconds())), 1)
+}
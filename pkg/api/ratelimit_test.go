@@ -0,0 +1,62 @@
+package api
+
+import (
+	"context"
+	"notification-system/pkg/config"
+	"notification-system/pkg/model"
+	"notification-system/pkg/ratelimit"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("limitRecipient", func() {
+	var (
+		s            *Server
+		notification model.Notification
+	)
+
+	BeforeEach(func() {
+		s = &Server{
+			cfg: &config.Config{
+				Server: config.ServerConfig{RequestTimeout: 5},
+				RateLimit: config.RateLimitConfig{
+					RecipientPerHour: map[model.NotificationChannel]int{model.ChannelSMS: 1},
+				},
+			},
+			limiter: ratelimit.NewMemoryLimiter(),
+		}
+		notification = model.Notification{Channel: model.ChannelSMS, Recipient: "+1234567890", Status: model.StatusPending}
+	})
+
+	It("should take no token for a suppressed notification", func() {
+		suppressed := notification
+		suppressed.Status = model.StatusSuppressed
+		_, ok := s.limitRecipient(context.Background(), &suppressed)
+		Expect(ok).To(BeTrue())
+
+		_, ok = s.limitRecipient(context.Background(), &notification)
+		Expect(ok).To(BeTrue())
+	})
+
+	It("should give back the token of a notification that was not saved", func() {
+		_, ok := s.limitRecipient(context.Background(), &notification)
+		Expect(ok).To(BeTrue())
+
+		s.refundRecipients(&notification)
+		_, ok = s.limitRecipient(context.Background(), &notification)
+		Expect(ok).To(BeTrue())
+	})
+
+	It("should not give back a token for a suppressed notification", func() {
+		_, ok := s.limitRecipient(context.Background(), &notification)
+		Expect(ok).To(BeTrue())
+
+		suppressed := notification
+		suppressed.Status = model.StatusSuppressed
+		s.refundRecipients(&suppressed)
+		allowed, _, err := s.limiter.Allow(context.Background(), recipientKey(&notification), s.recipientLimit(model.ChannelSMS), 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(allowed).To(BeFalse())
+	})
+})
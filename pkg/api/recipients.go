@@ -0,0 +1,199 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"notification-system/pkg/model"
+	"notification-system/pkg/storage"
+	"notification-system/pkg/validation"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultChannelOrder is used to pick a channel for users without channel preferences
+var defaultChannelOrder = []model.NotificationChannel{model.ChannelEmail, model.ChannelSMS, model.ChannelSlack}
+
+// errRecipientLookup is returned when a recipient could not be loaded for reasons other than not existing
+var errRecipientLookup = errors.New("failed to load recipient")
+
+func (s *Server) createRecipient(c *gin.Context) {
+	var recipient model.Recipient
+	if err := c.ShouldBindJSON(&recipient); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if err := validation.ValidateRecipient(&recipient); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid recipient: %v", err)})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	recipient.CreatedAt = time.Now()
+	recipient.UpdatedAt = recipient.CreatedAt
+
+	err := s.db.CreateRecipient(ctx, recipient)
+	if errors.Is(err, storage.ErrDuplicateRecipient) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Recipient %s already exists", recipient.ID)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save recipient"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, recipient)
+}
+
+func (s *Server) getRecipient(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	recipient, err := s.db.GetRecipientByID(ctx, c.Param("id"))
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recipient not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get recipient"})
+		return
+	}
+	c.JSON(http.StatusOK, recipient)
+}
+
+func (s *Server) updateRecipient(c *gin.Context) {
+	var recipient model.Recipient
+	if err := c.ShouldBindJSON(&recipient); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	recipient.ID = c.Param("id")
+	if err := validation.ValidateRecipient(&recipient); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid recipient: %v", err)})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	recipient.UpdatedAt = time.Now()
+
+	err := s.db.UpdateRecipient(ctx, recipient)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recipient not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update recipient"})
+		return
+	}
+
+	updated, err := s.db.GetRecipientByID(ctx, recipient.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get recipient"})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+func (s *Server) deleteRecipient(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	err := s.db.DeleteRecipient(ctx, c.Param("id"))
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recipient not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete recipient"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// resolveRecipient fills in the recipient of a notification addressed to a user from the directory.
+// Without a channel, the first channel from the user's preferences with a contact point is used.
+// Fallback targets without a recipient are resolved for their own user or the notification's user.
+// Recipients already loaded are taken from cache, which can be nil.
+func (s *Server) resolveRecipient(ctx context.Context, notification *model.Notification, cache map[string]*model.Recipient) error {
+	if notification.UserID != nil {
+		if notification.Recipient != "" {
+			return fmt.Errorf("recipient and userId cannot be used together")
+		}
+
+		channel, contact, err := s.lookupContact(ctx, *notification.UserID, notification.Channel, cache)
+		if err != nil {
+			return err
+		}
+		notification.Channel, notification.Recipient = channel, contact
+	}
+
+	for i := range notification.Fallback {
+		target := &notification.Fallback[i]
+		if target.Recipient != "" {
+			continue
+		}
+
+		userID := target.UserID
+		if userID == nil {
+			userID = notification.UserID
+		}
+		if userID == nil {
+			continue
+		}
+
+		channel, contact, err := s.lookupContact(ctx, *userID, target.Channel, cache)
+		if err != nil {
+			return fmt.Errorf("fallback %d: %w", i, err)
+		}
+		target.Channel, target.Recipient = channel, contact
+	}
+
+	return nil
+}
+
+// lookupContact returns the channel and contact point to reach a user on. An empty channel selects
+// the preferred one.
+func (s *Server) lookupContact(ctx context.Context, userID string, channel model.NotificationChannel, cache map[string]*model.Recipient) (model.NotificationChannel, string, error) {
+	recipient, ok := cache[userID]
+	if !ok {
+		var err error
+		recipient, err = s.db.GetRecipientByID(ctx, userID)
+		if errors.Is(err, storage.ErrNotFound) {
+			return "", "", fmt.Errorf("user %s not found", userID)
+		}
+		if err != nil {
+			return "", "", fmt.Errorf("%w %s: %v", errRecipientLookup, userID, err)
+		}
+		if cache != nil {
+			cache[userID] = recipient
+		}
+	}
+
+	if channel == "" {
+		preferences := recipient.Preferences
+		if len(preferences) == 0 {
+			preferences = defaultChannelOrder
+		}
+		for _, preferred := range preferences {
+			if _, ok := recipient.ContactFor(preferred); ok {
+				channel = preferred
+				break
+			}
+		}
+		if channel == "" {
+			return "", "", fmt.Errorf("user %s has no contact points", userID)
+		}
+	}
+
+	contact, ok := recipient.ContactFor(channel)
+	if !ok {
+		return "", "", fmt.Errorf("user %s has no contact point for channel %s", userID, channel)
+	}
+	return channel, contact, nil
+}
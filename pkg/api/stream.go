@@ -0,0 +1,84 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"notification-system/pkg/model"
+	"notification-system/pkg/stream"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamHeartbeatInterval keeps idle streams from being closed by proxies
+const streamHeartbeatInterval = 15 * time.Second
+
+// streamNotifications pushes the status changes of notifications as server-sent events. The
+// changes can be filtered by channel and notification IDs, given as repeated or comma separated
+// query parameters. Clients only see their own notifications, the admin can filter by client.
+func (s *Server) streamNotifications(c *gin.Context) {
+	filter := stream.Filter{ClientID: c.Query("clientId")}
+	if clientID := requestClientID(c); clientID != nil {
+		filter.ClientID = *clientID
+	}
+	for _, value := range queryList(c, "channel") {
+		channel := model.NotificationChannel(value)
+		if _, ok := s.cfg.RabbitMQ.ChannelQueues[channel]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown channel %s", channel)})
+			return
+		}
+		if filter.Channels == nil {
+			filter.Channels = make(map[model.NotificationChannel]bool)
+		}
+		filter.Channels[channel] = true
+	}
+	for _, id := range queryList(c, "ids") {
+		if filter.IDs == nil {
+			filter.IDs = make(map[string]bool)
+		}
+		filter.IDs[id] = true
+	}
+
+	changes, unsubscribe := s.broker.Subscribe(filter)
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	// The stream ends when the client disconnects or falls too far behind, clients reconnect then
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case change, ok := <-changes:
+			if !ok {
+				return false
+			}
+			c.SSEvent("status", change)
+			return true
+		case <-heartbeat.C:
+			io.WriteString(w, ": heartbeat\n\n")
+			return true
+		}
+	})
+}
+
+// queryList returns the values of a repeated or comma separated query parameter
+func queryList(c *gin.Context, key string) []string {
+	var values []string
+	for _, param := range c.QueryArray(key) {
+		for _, value := range strings.Split(param, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"notification-system/pkg/model"
+	"notification-system/pkg/storage"
+	"notification-system/pkg/validation"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func (s *Server) createSuppression(c *gin.Context) {
+	var suppression model.Suppression
+	if err := c.ShouldBindJSON(&suppression); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if err := validation.ValidateSuppression(&suppression); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid suppression: %v", err)})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	suppression.ID = uuid.New().String()
+	suppression.CreatedAt = time.Now()
+
+	err := s.db.CreateSuppression(ctx, suppression)
+	if errors.Is(err, storage.ErrDuplicateSuppression) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Recipient %s is already suppressed for %s", suppression.Recipient, suppression.Channel)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save suppression"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, suppression)
+}
+
+func (s *Server) listSuppressions(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	suppressions, err := s.db.ListSuppressions(ctx, c.Query("channel"), c.Query("recipient"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list suppressions"})
+		return
+	}
+	c.JSON(http.StatusOK, suppressions)
+}
+
+func (s *Server) deleteSuppression(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	err := s.db.DeleteSuppression(ctx, c.Param("id"))
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Suppression not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete suppression"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// markSuppressed sets the status of new notifications to suppressed if their recipient opted out
+// of the channel or category. Suppressed notifications are stored but never sent.
+func (s *Server) markSuppressed(ctx context.Context, notifications []*model.Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+
+	toCheck := make([]model.Notification, len(notifications))
+	for i, notification := range notifications {
+		toCheck[i] = *notification
+	}
+
+	suppressed, err := s.db.SuppressedNotifications(ctx, toCheck)
+	if err != nil {
+		return err
+	}
+
+	for _, notification := range notifications {
+		if suppressed[notification.ID] {
+			notification.Status = model.StatusSuppressed
+		}
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"notification-system/pkg/model"
+	"notification-system/pkg/storage"
+	"notification-system/pkg/templates"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// errTemplateLookup is returned when a template could not be loaded for reasons other than not existing
+var errTemplateLookup = errors.New("failed to load template")
+
+func (s *Server) createTemplate(c *gin.Context) {
+	var template model.Template
+	if err := c.ShouldBindJSON(&template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if err := templates.Validate(&template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid template: %v", err)})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	template.ID = uuid.New().String()
+	template.CreatedAt = time.Now()
+	if template.Locale == "" {
+		template.Locale = s.cfg.Templates.DefaultLocale
+	}
+	template.Locale = templates.NormalizeLocale(template.Locale)
+
+	created, err := s.db.CreateTemplate(ctx, template)
+	if errors.Is(err, storage.ErrDuplicateTemplate) {
+		// A concurrent request created the same version
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Template %s (%s) was created concurrently, please retry", template.Name, template.Locale)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save template"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+func (s *Server) listTemplates(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	templates, err := s.db.ListTemplates(ctx, c.Query("name"), c.Query("locale"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list templates"})
+		return
+	}
+	c.JSON(http.StatusOK, templates)
+}
+
+func (s *Server) getTemplate(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	template, err := s.db.GetTemplateByID(ctx, c.Param("id"))
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get template"})
+		return
+	}
+	c.JSON(http.StatusOK, template)
+}
+
+func (s *Server) updateTemplate(c *gin.Context) {
+	var template model.Template
+	if err := c.ShouldBindJSON(&template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if err := templates.Validate(&template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid template: %v", err)})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	template.ID = c.Param("id")
+	template.UpdatedAt = time.Now()
+
+	err := s.db.UpdateTemplate(ctx, template)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	case errors.Is(err, storage.ErrTemplatePublished):
+		c.JSON(http.StatusConflict, gin.H{"error": "Published template versions cannot be changed, create a new version instead"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update template"})
+		return
+	}
+
+	updated, err := s.db.GetTemplateByID(ctx, template.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get template"})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+func (s *Server) publishTemplate(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	template, err := s.db.PublishTemplate(ctx, c.Param("id"))
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to publish template"})
+		return
+	}
+	c.JSON(http.StatusOK, template)
+}
+
+func (s *Server) deleteTemplate(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	err := s.db.DeleteTemplate(ctx, c.Param("id"))
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete template"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// applyTemplate renders the template of a notification, if it has one, into its message and metadata.
+// The template is either the one with TemplateID, or the published version of TemplateName for the
+// requested locale, falling back to the base language and the default locale. The locale comes from
+// the Locale field or the locale metadata. Templates already loaded are taken from cache, which can be nil.
+func (s *Server) applyTemplate(ctx context.Context, notification *model.Notification, cache map[string]*model.Template) error {
+	if notification.TemplateID == nil && notification.TemplateName == nil {
+		return nil
+	}
+
+	var key string
+	var load func() (*model.Template, error)
+	if notification.TemplateID != nil {
+		id := *notification.TemplateID
+		key = id
+		load = func() (*model.Template, error) {
+			return s.db.GetTemplateByID(ctx, id)
+		}
+	} else {
+		locale := notification.Metadata[model.MetadataLocale]
+		if notification.Locale != nil {
+			locale = *notification.Locale
+		}
+		locales := templates.LocaleCandidates(locale, s.cfg.Templates.DefaultLocale)
+
+		key = fmt.Sprintf("%s/%s", *notification.TemplateName, strings.Join(locales, ","))
+		if notification.TemplateVersion != nil {
+			key = fmt.Sprintf("%s/v%d", key, *notification.TemplateVersion)
+		}
+		load = func() (*model.Template, error) {
+			return s.db.ResolveTemplate(ctx, *notification.TemplateName, locales, notification.TemplateVersion)
+		}
+	}
+
+	template, ok := cache[key]
+	if !ok {
+		var err error
+		template, err = load()
+		if errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("template %s not found", key)
+		}
+		if err != nil {
+			return fmt.Errorf("%w %s: %v", errTemplateLookup, key, err)
+		}
+		if cache != nil {
+			cache[key] = template
+			cache[template.ID] = template
+		}
+	}
+
+	// Keep track of the exact template version the notification was rendered from
+	notification.TemplateID = &template.ID
+	return templates.Render(template, notification)
+}
+
+// validate validates a notification and its fallback targets. A templated notification is rendered
+// again for every fallback target, the way the worker does when falling back, so every target is
+// validated against its own rendering. Templates already loaded are taken from cache, which can be nil.
+func (s *Server) validate(ctx context.Context, notification *model.Notification, cache map[string]*model.Template) error {
+	if err := s.validator.Validate(notification); err != nil {
+		return err
+	}
+	if notification.TemplateID == nil || len(notification.Fallback) == 0 {
+		return nil
+	}
+
+	template, ok := cache[*notification.TemplateID]
+	if !ok {
+		var err error
+		template, err = s.db.GetTemplateByID(ctx, *notification.TemplateID)
+		if err != nil {
+			return fmt.Errorf("%w %s: %v", errTemplateLookup, *notification.TemplateID, err)
+		}
+	}
+
+	for i, target := range notification.Fallback {
+		fallback := *notification
+		fallback.Channel = target.Channel
+		fallback.Recipient = target.Recipient
+		fallback.Fallback = nil
+		if err := templates.RenderFallback(template, &fallback); err != nil {
+			return fmt.Errorf("fallback %d: %w", i, err)
+		}
+		if err := s.validator.Validate(&fallback); err != nil {
+			return fmt.Errorf("fallback %d: %w", i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"notification-system/pkg/model"
+	"notification-system/pkg/storage"
+	"notification-system/pkg/webhooks"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sendgrid/sendgrid-go/helpers/eventwebhook"
+	"github.com/twilio/twilio-go/client"
+)
+
+const twilioSignatureHeader = "X-Twilio-Signature"
+
+// earlyReceiptWindow is how long a receipt for an unknown provider message ID is taken for one that
+// arrived before the worker stored the ID. Older ones are acknowledged and dropped, so providers do
+// not retry the receipts of messages sent by other systems or deleted since for days.
+const earlyReceiptWindow = 5 * time.Minute
+
+// twilioStatuses maps the final Twilio message statuses to notification statuses
+var twilioStatuses = map[string]model.NotificationStatus{
+	"delivered":   model.StatusDelivered,
+	"undelivered": model.StatusUndelivered,
+	"failed":      model.StatusUndelivered,
+}
+
+// sendgridStatuses maps the SendGrid delivery events to notification statuses
+var sendgridStatuses = map[string]model.NotificationStatus{
+	"delivered": model.StatusDelivered,
+	"bounce":    model.StatusBounced,
+	"dropped":   model.StatusUndelivered,
+}
+
+// sendgridEvent is the part of a SendGrid event webhook entry used for delivery receipts
+type sendgridEvent struct {
+	Event       string `json:"event"`
+	SGMessageID string `json:"sg_message_id"`
+	Reason      string `json:"reason"`
+	Timestamp   int64  `json:"timestamp"`
+}
+
+// unknownReceipts remembers when the receipts for unknown message IDs were first received, since
+// Twilio status callbacks carry no event time
+type unknownReceipts struct {
+	mu        sync.Mutex
+	firstSeen map[string]time.Time
+}
+
+func newUnknownReceipts() *unknownReceipts {
+	return &unknownReceipts{firstSeen: make(map[string]time.Time)}
+}
+
+// early reports whether a receipt for an unknown message ID received now may still be early. The
+// IDs are forgotten well after the window ends, so late retries are not taken for new receipts.
+func (r *unknownReceipts) early(messageID string, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, seen := range r.firstSeen {
+		if now.Sub(seen) >= 2*earlyReceiptWindow {
+			delete(r.firstSeen, id)
+		}
+	}
+
+	seen, ok := r.firstSeen[messageID]
+	if !ok {
+		r.firstSeen[messageID] = now
+		return true
+	}
+	return now.Sub(seen) < earlyReceiptWindow
+}
+
+// twilioStatusCallback handles the delivery status callbacks Twilio sends for SMS messages
+func (s *Server) twilioStatusCallback(c *gin.Context) {
+	if s.cfg.Twilio.StatusCallbackURL == "" || s.cfg.Twilio.AuthToken == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Twilio status callbacks are not configured"})
+		return
+	}
+
+	if err := c.Request.ParseForm(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	params := make(map[string]string, len(c.Request.PostForm))
+	for key := range c.Request.PostForm {
+		params[key] = c.Request.PostForm.Get(key)
+	}
+
+	validator := client.NewRequestValidator(s.cfg.Twilio.AuthToken)
+	if !validator.Validate(s.cfg.Twilio.StatusCallbackURL, params, c.GetHeader(twilioSignatureHeader)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid signature"})
+		return
+	}
+
+	// Intermediate statuses like queued or sent are not tracked
+	status, ok := twilioStatuses[params["MessageStatus"]]
+	if !ok {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	var reason *string
+	if code := params["ErrorCode"]; code != "" {
+		reason = &code
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	notification, err := s.db.UpdateDeliveryStatus(ctx, model.ChannelSMS, params["MessageSid"], status, reason)
+	if errors.Is(err, storage.ErrNotFound) {
+		// The receipt can arrive before the worker stored the message SID, Twilio sends it again
+		if s.receipts.early(params["MessageSid"], time.Now()) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Notification not found yet"})
+			return
+		}
+		log.Printf("Dropping Twilio status callback for unknown message %s", params["MessageSid"])
+		c.Status(http.StatusNoContent)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to apply Twilio status callback for %s: %v", params["MessageSid"], err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification"})
+		return
+	}
+	if notification != nil {
+		s.queueWebhookEvent(ctx, *notification)
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// sendgridEventWebhook handles the signed event webhook SendGrid sends for emails
+func (s *Server) sendgridEventWebhook(c *gin.Context) {
+	if s.cfg.Email.WebhookPublicKey == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "SendGrid event webhooks are not configured"})
+		return
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	publicKey, err := eventwebhook.ConvertPublicKeyBase64ToECDSA(s.cfg.Email.WebhookPublicKey)
+	if err != nil {
+		log.Printf("Invalid SendGrid webhook public key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify signature"})
+		return
+	}
+	valid, err := eventwebhook.VerifySignature(publicKey, body,
+		c.GetHeader(eventwebhook.VerificationHTTPHeader), c.GetHeader(eventwebhook.TimestampHTTPHeader))
+	if err != nil || !valid {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid signature"})
+		return
+	}
+
+	var events []sendgridEvent
+	if err := json.Unmarshal(body, &events); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(s.cfg.Server.RequestTimeout)*time.Second)
+	defer cancel()
+
+	early := false
+	for _, event := range events {
+		status, ok := sendgridStatuses[event.Event]
+		if !ok {
+			continue
+		}
+
+		// The event message ID starts with the X-Message-Id returned when sending
+		messageID, _, _ := strings.Cut(event.SGMessageID, ".")
+
+		var reason *string
+		if event.Reason != "" {
+			reason = &event.Reason
+		}
+
+		notification, err := s.db.UpdateDeliveryStatus(ctx, model.ChannelEmail, messageID, status, reason)
+		if errors.Is(err, storage.ErrNotFound) {
+			// The event can arrive before the worker stored the message ID
+			if time.Since(time.Unix(event.Timestamp, 0)) < earlyReceiptWindow {
+				early = true
+			} else {
+				log.Printf("Dropping SendGrid event %s for unknown message %s", event.Event, messageID)
+			}
+			continue
+		}
+		if err != nil {
+			// SendGrid retries the whole batch, events applied already are skipped then
+			log.Printf("Failed to apply SendGrid event %s for %s: %v", event.Event, messageID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification"})
+			return
+		}
+		if notification != nil {
+			s.queueWebhookEvent(ctx, *notification)
+		}
+	}
+
+	if early {
+		// SendGrid sends the batch again, and the events applied now are skipped then
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Notification not found yet"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// queueWebhookEvent stores the webhook event for the new delivery status of a notification, which
+// the worker posts to its callback URL. Failures are only logged, the receipt is applied anyway.
+func (s *Server) queueWebhookEvent(ctx context.Context, notification model.Notification) {
+	event, ok, err := webhooks.NewEvent(notification)
+	if err == nil && ok {
+		err = s.db.CreateWebhookEvent(ctx, event)
+	}
+	if err != nil {
+		log.Printf("Failed to queue webhook event of notification %s: %v", notification.ID, err)
+	}
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("unknownReceipts", func() {
+	var (
+		receipts *unknownReceipts
+		start    time.Time
+	)
+
+	BeforeEach(func() {
+		receipts = newUnknownReceipts()
+		start = time.Now()
+	})
+
+	It("should take the retries of a receipt for early ones during the window", func() {
+		Expect(receipts.early("SM1", start)).To(BeTrue())
+		Expect(receipts.early("SM1", start.Add(4*time.Minute))).To(BeTrue())
+	})
+
+	It("should stop taking a receipt for an early one after the window", func() {
+		Expect(receipts.early("SM1", start)).To(BeTrue())
+		Expect(receipts.early("SM1", start.Add(earlyReceiptWindow))).To(BeFalse())
+		Expect(receipts.early("SM1", start.Add(earlyReceiptWindow+time.Minute))).To(BeFalse())
+	})
+
+	It("should start the window of every message ID on its first receipt", func() {
+		Expect(receipts.early("SM1", start)).To(BeTrue())
+		Expect(receipts.early("SM2", start.Add(earlyReceiptWindow))).To(BeTrue())
+		Expect(receipts.early("SM1", start.Add(earlyReceiptWindow))).To(BeFalse())
+	})
+
+	It("should forget message IDs well after their window", func() {
+		Expect(receipts.early("SM1", start)).To(BeTrue())
+		Expect(receipts.early("SM2", start.Add(2*earlyReceiptWindow))).To(BeTrue())
+		Expect(receipts.firstSeen).NotTo(HaveKey("SM1"))
+	})
+})
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+const (
+	// keyPrefix marks API keys of this system, so leaked ones are easy to recognize
+	keyPrefix = "nsk_"
+	// keyBytes is the number of random bytes in an API key
+	keyBytes = 32
+	// displayLength is the number of leading characters of a key kept to identify it in listings
+	displayLength = len(keyPrefix) + 8
+)
+
+// GenerateKey returns a new random API key together with its display prefix. Only the hash of
+// the key is stored, so the key itself can be shown just once.
+func GenerateKey() (key, prefix string, err error) {
+	buf := make([]byte, keyBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	key = keyPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	return key, key[:displayLength], nil
+}
+
+// HashKey returns the hex encoded SHA-256 hash an API key is stored and looked up by. API keys
+// are long random strings, so a fast hash is enough.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Matches compares an API key with the expected one in constant time
+func Matches(key, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(key), []byte(expected)) == 1
+}
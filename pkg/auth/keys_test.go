@@ -0,0 +1,31 @@
+package auth
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("API keys", func() {
+	It("should generate distinct keys with their display prefix", func() {
+		key, prefix, err := GenerateKey()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(key).To(HavePrefix(keyPrefix))
+		Expect(key).To(HavePrefix(prefix))
+		Expect(prefix).To(HaveLen(displayLength))
+
+		other, _, err := GenerateKey()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(other).NotTo(Equal(key))
+	})
+
+	It("should hash keys deterministically", func() {
+		Expect(HashKey("nsk_test")).To(Equal(HashKey("nsk_test")))
+		Expect(HashKey("nsk_test")).NotTo(Equal(HashKey("nsk_other")))
+		Expect(HashKey("nsk_test")).To(HaveLen(64))
+	})
+
+	It("should compare keys", func() {
+		Expect(Matches("nsk_test", "nsk_test")).To(BeTrue())
+		Expect(Matches("nsk_test", "nsk_tes")).To(BeFalse())
+	})
+})
@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 
 	"notification-system/pkg/model"
 
@@ -14,6 +15,9 @@ type ServerConfig struct {
 	Port            string
 	Host            string
 	RequestTimeout  int // in seconds
+	IdempotencyWindow int // in minutes, 0 keeps idempotency keys forever
+	MaxBatchSize      int // maximum number of notifications in a batch request, 0 means unlimited
+	AdminAPIKey       string // manages API keys and DLQs, and sees the notifications of all clients
 }
 
 type DatabaseConfig struct {
@@ -42,6 +46,8 @@ type TwilioConfig struct {
 	AccountSID string
 	AuthToken  string
 	FromNumber string
+	// StatusCallbackURL is the public URL of the Twilio status callback endpoint of the API
+	StatusCallbackURL string
 }
 
 type SlackConfig struct {
@@ -53,6 +59,8 @@ type EmailConfig struct {
 	FromAddress    string
 	FromName       string
 	DefaultSubject string
+	// WebhookPublicKey verifies the signature of SendGrid event webhooks
+	WebhookPublicKey string
 }
 
 type RetryConfig struct {
@@ -62,6 +70,51 @@ type RetryConfig struct {
 	ProcessTimeout  int // in seconds
 }
 
+// ConsumerConfig sets how many notifications of a channel a worker processes at once
+type ConsumerConfig struct {
+	Concurrency int // consumers of the channel queue, 1 by default
+	Prefetch    int // unacknowledged messages delivered to each consumer, 1 by default
+}
+
+type TemplateConfig struct {
+	DefaultLocale string
+}
+
+type RelayConfig struct {
+	PollIntervalMs int
+	BatchSize      int
+	GracePeriodMs  int // how long the API has to publish a new notification before the relay does
+}
+
+// RateLimitConfig limits the requests of every client and the notifications sent to a single
+// recipient. Zero values disable a limit.
+type RateLimitConfig struct {
+	Store                   string // "memory" (default) or "postgres" to share the limits between instances
+	ClientRequestsPerSecond float64
+	ClientBurst             int
+	RecipientPerHour        map[model.NotificationChannel]int
+	Providers               map[model.NotificationChannel]ProviderLimitConfig
+}
+
+// ProviderLimitConfig is the outbound throughput of the provider of a channel, shared by all
+// workers. Zero values disable a limit.
+type ProviderLimitConfig struct {
+	RequestsPerSecond float64
+	Burst             int
+	MaxInFlight       int
+}
+
+// WebhookConfig controls the delivery of status events to the callback URLs of notifications
+type WebhookConfig struct {
+	SigningSecret  string // signs the events with HMAC-SHA256
+	MaxAttempts    int
+	InitialDelayMs int
+	MaxDelayMs     int
+	TimeoutSeconds int
+	PollIntervalMs int
+	BatchSize      int
+}
+
 type Config struct {
 	Server   ServerConfig
 	Database DatabaseConfig
@@ -70,7 +123,13 @@ type Config struct {
 	Slack    SlackConfig
 	Email    EmailConfig
 	Retry    RetryConfig
+	Consumers map[model.NotificationChannel]ConsumerConfig
+	Relay    RelayConfig
+	Webhooks WebhookConfig
+	RateLimit RateLimitConfig
+	Templates TemplateConfig
 	UseMockProviders bool
+	ShutdownTimeout  int // in seconds, how long in-flight requests and notifications get to finish
 }
 
 func LoadConfig(filename string) (*Config, error) {
@@ -83,7 +142,7 @@ func LoadConfig(filename string) (*Config, error) {
 	} else {
 		err := godotenv.Load(filename)
 		if err != nil {
-			log.Fatalf("Error loading %s file", filename, err)
+			log.Fatalf("Error loading %s file: %v", filename, err)
 			return nil, err
 		}
 	}
@@ -103,11 +162,16 @@ func InitConfigValues()  *Config  {
 	queryTimeout, _ := strconv.Atoi(os.Getenv("DB_QUERY_TIMEOUT_SECONDS"))
 
 	requestTimeout, _ := strconv.Atoi(os.Getenv("REQUEST_TIMEOUT_SECONDS"))
+	idempotencyWindow, _ := strconv.Atoi(os.Getenv("IDEMPOTENCY_WINDOW_MINUTES"))
+	maxBatchSize, _ := strconv.Atoi(os.Getenv("MAX_BATCH_SIZE"))
 
 	serverConfig := ServerConfig{
 		Port:           os.Getenv("SERVER_PORT"),
 		Host:           os.Getenv("SERVER_HOST"),
 		RequestTimeout: requestTimeout,
+		IdempotencyWindow: idempotencyWindow,
+		MaxBatchSize:      maxBatchSize,
+		AdminAPIKey:       os.Getenv("ADMIN_API_KEY"),
 	}
 
 	dbConfig := DatabaseConfig{
@@ -136,9 +200,10 @@ func InitConfigValues()  *Config  {
 	}
 
 	twilioConfig := TwilioConfig{
-		AccountSID: os.Getenv("TWILIO_ACCOUNT_SID"),
-		AuthToken:  os.Getenv("TWILIO_AUTH_TOKEN"),
-		FromNumber: os.Getenv("TWILIO_FROM_NUMBER"),
+		AccountSID:        os.Getenv("TWILIO_ACCOUNT_SID"),
+		AuthToken:         os.Getenv("TWILIO_AUTH_TOKEN"),
+		FromNumber:        os.Getenv("TWILIO_FROM_NUMBER"),
+		StatusCallbackURL: os.Getenv("TWILIO_STATUS_CALLBACK_URL"),
 	}
 
 	slackConfig := SlackConfig{
@@ -146,10 +211,11 @@ func InitConfigValues()  *Config  {
 	}
 
 	emailConfig := EmailConfig{
-		SendGridAPIKey: os.Getenv("SENDGRID_API_KEY"),
-		FromAddress:    os.Getenv("SENDGRID_FROM_ADDRESS"),
-		FromName:       os.Getenv("SENDGRID_FROM_NAME"),
-		DefaultSubject: os.Getenv("EMAIL_DEFAULT_SUBJECT"),
+		SendGridAPIKey:   os.Getenv("SENDGRID_API_KEY"),
+		FromAddress:      os.Getenv("SENDGRID_FROM_ADDRESS"),
+		FromName:         os.Getenv("SENDGRID_FROM_NAME"),
+		DefaultSubject:   os.Getenv("EMAIL_DEFAULT_SUBJECT"),
+		WebhookPublicKey: os.Getenv("SENDGRID_WEBHOOK_PUBLIC_KEY"),
 	}
 
 	retryConfig := RetryConfig{
@@ -159,7 +225,81 @@ func InitConfigValues()  *Config  {
 		ProcessTimeout: processTimeout,
 	}
 
+	consumers := make(map[model.NotificationChannel]ConsumerConfig)
+	for _, channel := range []model.NotificationChannel{model.ChannelSMS, model.ChannelEmail, model.ChannelSlack} {
+		prefix := "WORKER_" + strings.ToUpper(string(channel)) + "_"
+		concurrency, _ := strconv.Atoi(os.Getenv(prefix + "CONCURRENCY"))
+		prefetch, _ := strconv.Atoi(os.Getenv(prefix + "PREFETCH"))
+		consumers[channel] = ConsumerConfig{
+			Concurrency: concurrency,
+			Prefetch:    prefetch,
+		}
+	}
+
+	relayPollIntervalMs, _ := strconv.Atoi(os.Getenv("RELAY_POLL_INTERVAL_MS"))
+	relayBatchSize, _ := strconv.Atoi(os.Getenv("RELAY_BATCH_SIZE"))
+	relayGracePeriodMs, _ := strconv.Atoi(os.Getenv("RELAY_GRACE_PERIOD_MS"))
+
+	relayConfig := RelayConfig{
+		PollIntervalMs: relayPollIntervalMs,
+		BatchSize:      relayBatchSize,
+		GracePeriodMs:  relayGracePeriodMs,
+	}
+
+	webhookMaxAttempts, _ := strconv.Atoi(os.Getenv("WEBHOOK_MAX_ATTEMPTS"))
+	webhookInitialDelayMs, _ := strconv.Atoi(os.Getenv("WEBHOOK_INITIAL_RETRY_DELAY_MS"))
+	webhookMaxDelayMs, _ := strconv.Atoi(os.Getenv("WEBHOOK_MAX_RETRY_DELAY_MS"))
+	webhookTimeout, _ := strconv.Atoi(os.Getenv("WEBHOOK_TIMEOUT_SECONDS"))
+	webhookPollIntervalMs, _ := strconv.Atoi(os.Getenv("WEBHOOK_POLL_INTERVAL_MS"))
+	webhookBatchSize, _ := strconv.Atoi(os.Getenv("WEBHOOK_BATCH_SIZE"))
+
+	webhookConfig := WebhookConfig{
+		SigningSecret:  os.Getenv("WEBHOOK_SIGNING_SECRET"),
+		MaxAttempts:    webhookMaxAttempts,
+		InitialDelayMs: webhookInitialDelayMs,
+		MaxDelayMs:     webhookMaxDelayMs,
+		TimeoutSeconds: webhookTimeout,
+		PollIntervalMs: webhookPollIntervalMs,
+		BatchSize:      webhookBatchSize,
+	}
+
+	clientRequestsPerSecond, _ := strconv.ParseFloat(os.Getenv("RATE_LIMIT_CLIENT_RPS"), 64)
+	clientBurst, _ := strconv.Atoi(os.Getenv("RATE_LIMIT_CLIENT_BURST"))
+	smsPerHour, _ := strconv.Atoi(os.Getenv("RATE_LIMIT_SMS_PER_RECIPIENT_HOUR"))
+	emailPerHour, _ := strconv.Atoi(os.Getenv("RATE_LIMIT_EMAIL_PER_RECIPIENT_HOUR"))
+	slackPerHour, _ := strconv.Atoi(os.Getenv("RATE_LIMIT_SLACK_PER_RECIPIENT_HOUR"))
+
+	providerLimits := make(map[model.NotificationChannel]ProviderLimitConfig)
+	for _, channel := range []model.NotificationChannel{model.ChannelSMS, model.ChannelEmail, model.ChannelSlack} {
+		prefix := "RATE_LIMIT_" + strings.ToUpper(string(channel)) + "_PROVIDER_"
+		requestsPerSecond, _ := strconv.ParseFloat(os.Getenv(prefix+"RPS"), 64)
+		burst, _ := strconv.Atoi(os.Getenv(prefix + "BURST"))
+		maxInFlight, _ := strconv.Atoi(os.Getenv(prefix + "MAX_IN_FLIGHT"))
+		providerLimits[channel] = ProviderLimitConfig{
+			RequestsPerSecond: requestsPerSecond,
+			Burst:             burst,
+			MaxInFlight:       maxInFlight,
+		}
+	}
+
+	rateLimitConfig := RateLimitConfig{
+		Store:                   os.Getenv("RATE_LIMIT_STORE"),
+		ClientRequestsPerSecond: clientRequestsPerSecond,
+		ClientBurst:             clientBurst,
+		RecipientPerHour: map[model.NotificationChannel]int{
+			model.ChannelSMS:   smsPerHour,
+			model.ChannelEmail: emailPerHour,
+			model.ChannelSlack: slackPerHour,
+		},
+		Providers: providerLimits,
+	}
+
+	templateConfig := TemplateConfig{
+		DefaultLocale: os.Getenv("TEMPLATE_DEFAULT_LOCALE"),
+	}
+
 	useMockProviders, _ := strconv.ParseBool(os.Getenv("USE_MOCK_PROVIDERS"))
+	shutdownTimeout, _ := strconv.Atoi(os.Getenv("SHUTDOWN_TIMEOUT_SECONDS"))
 
 	return &Config{
 		Server:   serverConfig,
@@ -169,6 +309,12 @@ func InitConfigValues()  *Config  {
 		Slack:    slackConfig,
 		Email:    emailConfig,
 		Retry:    retryConfig,
+		Consumers: consumers,
+		Relay:    relayConfig,
+		Webhooks: webhookConfig,
+		RateLimit: rateLimitConfig,
+		Templates: templateConfig,
 		UseMockProviders: useMockProviders,
+		ShutdownTimeout:  shutdownTimeout,
 	}
 }
\ No newline at end of file
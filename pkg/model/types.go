@@ -1,6 +1,9 @@
 package model
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type NotificationStatus string
 
@@ -8,6 +11,15 @@ const (
 	StatusPending NotificationStatus = "pending"
 	StatusSent    NotificationStatus = "sent"
 	StatusFailed  NotificationStatus = "failed"
+	StatusScheduled NotificationStatus = "scheduled"
+	StatusCancelled NotificationStatus = "cancelled"
+	StatusSuppressed NotificationStatus = "suppressed"
+	// Delivery receipts of the providers move sent notifications into the statuses below
+	StatusDelivered   NotificationStatus = "delivered"
+	StatusBounced     NotificationStatus = "bounced"
+	StatusUndelivered NotificationStatus = "undelivered"
+	// StatusPartial is only used for the aggregated status of a message whose notifications ended differently
+	StatusPartial NotificationStatus = "partial"
 )
 
 type NotificationChannel string
@@ -18,6 +30,29 @@ const (
 	ChannelSlack NotificationChannel = "slack"
 )
 
+type NotificationPriority string
+
+const (
+	PriorityLow    NotificationPriority = "low"
+	PriorityNormal NotificationPriority = "normal"
+	PriorityHigh   NotificationPriority = "high"
+	// PriorityCritical notifications are sent even during the quiet hours of the recipient
+	PriorityCritical NotificationPriority = "critical"
+)
+
+// Metadata keys understood by the notification providers
+const (
+	MetadataEmailSubject = "email_subject"
+	MetadataEmailHTML    = "email_html"
+	MetadataSlackBlocks  = "slack_blocks"
+)
+
+// Metadata keys used by the API
+const (
+	MetadataLocale   = "locale"
+	MetadataCategory = "category"
+)
+
 type Notification struct {
 	ID        string            `db:"id" json:"id"`
 	Channel   NotificationChannel `db:"channel" json:"channel"`
@@ -29,4 +64,199 @@ type Notification struct {
 	LastError *string           `db:"last_error" json:"lastError,omitempty"`
 	CreatedAt time.Time         `db:"created_at" json:"createdAt"`
 	LastTried *time.Time        `db:"last_tried" json:"lastTried,omitempty"`
+	IdempotencyKey *string      `db:"idempotency_key" json:"idempotencyKey,omitempty"`
+	SendAt    *time.Time        `db:"send_at" json:"sendAt,omitempty"`
+	MessageID *string           `db:"message_id" json:"messageId,omitempty"`
+	// Fallback lists the targets tried one after another when delivery to the recipient fails
+	Fallback    []Target        `db:"fallback" json:"fallback,omitempty"`
+	FallbackFor *string         `db:"fallback_for" json:"fallbackFor,omitempty"`
+	// The template is selected by TemplateID, or by TemplateName with an optional TemplateVersion
+	// and Locale, and is rendered with Variables into Message and the rich content metadata
+	TemplateID      *string     `db:"template_id" json:"templateId,omitempty"`
+	TemplateName    *string     `db:"-" json:"templateName,omitempty"`
+	TemplateVersion *int        `db:"-" json:"templateVersion,omitempty"`
+	Locale          *string     `db:"-" json:"locale,omitempty"`
+	Variables   map[string]interface{} `db:"template_variables" json:"variables,omitempty"`
+	// UserID selects a recipient from the directory, whose contact point for the channel is used
+	UserID      *string         `db:"user_id" json:"userId,omitempty"`
+	Priority    NotificationPriority `db:"priority" json:"priority,omitempty"`
+	// ProviderMessageID identifies the sent message at the provider, e.g. the Twilio message SID
+	ProviderMessageID *string `db:"provider_message_id" json:"providerMessageId,omitempty"`
+	// CallbackURL receives a signed webhook event whenever the notification is sent, fails or is delivered
+	CallbackURL *string `db:"callback_url" json:"callbackUrl,omitempty"`
+	// ClientID is the client whose API key created the notification, it is empty for the admin key
+	ClientID *string `db:"client_id" json:"clientId,omitempty"`
+}
+
+// StatusChange is published whenever a notification is created or its status is written
+type StatusChange struct {
+	ID        string              `json:"id"`
+	Channel   NotificationChannel `json:"channel"`
+	Status    NotificationStatus  `json:"status"`
+	Attempts  int                 `json:"attempts"`
+	MessageID *string             `json:"messageId,omitempty"`
+	ClientID  *string             `json:"clientId,omitempty"`
+	ChangedAt time.Time           `json:"changedAt"`
+}
+
+// Target is a channel and recipient pair a message is delivered to. The recipient can be looked
+// up from the directory by UserID instead.
+type Target struct {
+	Channel   NotificationChannel `json:"channel"`
+	Recipient string              `json:"recipient,omitempty"`
+	UserID    *string             `json:"userId,omitempty"`
+}
+
+// Message is delivered to several targets at once, with a child notification per target
+type Message struct {
+	ID            string             `db:"id" json:"id"`
+	Message       string             `db:"message" json:"message"`
+	Metadata      map[string]string  `db:"metadata" json:"metadata"`
+	Targets       []Target           `json:"targets,omitempty"`
+	TemplateID    *string            `json:"templateId,omitempty"`
+	TemplateName    *string          `json:"templateName,omitempty"`
+	TemplateVersion *int             `json:"templateVersion,omitempty"`
+	Locale          *string          `json:"locale,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	SendAt        *time.Time         `json:"sendAt,omitempty"`
+	Priority      NotificationPriority `json:"priority,omitempty"`
+	CallbackURL   *string            `json:"callbackUrl,omitempty"`
+	ClientID      *string            `db:"client_id" json:"clientId,omitempty"`
+	Status        NotificationStatus `json:"status"`
+	Notifications []Notification     `json:"notifications,omitempty"`
+	CreatedAt     time.Time          `db:"created_at" json:"createdAt"`
+}
+
+// Template holds per-channel message bodies rendered with Go templates. Templates are identified by
+// name, locale and version, and only published versions are used when resolving them by name.
+type Template struct {
+	ID           string          `db:"id" json:"id"`
+	Name         string          `db:"name" json:"name"`
+	Locale       string          `db:"locale" json:"locale"`
+	Version      int             `db:"version" json:"version"`
+	PublishedAt  *time.Time      `db:"published_at" json:"publishedAt,omitempty"`
+	SMSBody      string          `db:"sms_body" json:"smsBody,omitempty"`
+	EmailSubject string          `db:"email_subject" json:"emailSubject,omitempty"`
+	EmailText    string          `db:"email_text" json:"emailText,omitempty"`
+	EmailHTML    string          `db:"email_html" json:"emailHtml,omitempty"`
+	SlackText    string          `db:"slack_text" json:"slackText,omitempty"`
+	SlackBlocks  json.RawMessage `db:"slack_blocks" json:"slackBlocks,omitempty"`
+	CreatedAt    time.Time       `db:"created_at" json:"createdAt"`
+	UpdatedAt    time.Time       `db:"updated_at" json:"updatedAt"`
+}
+
+// Recipient holds the contact points of a user, identified by the ID used in the calling services
+type Recipient struct {
+	ID           string  `db:"id" json:"id"`
+	Email        *string `db:"email" json:"email,omitempty"`
+	Phone        *string `db:"phone" json:"phone,omitempty"`
+	SlackChannel *string `db:"slack_channel" json:"slackChannel,omitempty"`
+	// Preferences lists the channels to use, most preferred first, when a notification does not name one
+	Preferences []NotificationChannel `db:"preferences" json:"preferences,omitempty"`
+	// Non-critical notifications are held back during the quiet hours, which are in the time zone
+	// of the recipient (an IANA name, UTC by default)
+	TimeZone   *string               `db:"time_zone" json:"timeZone,omitempty"`
+	QuietHours []QuietWindow         `db:"quiet_hours" json:"quietHours,omitempty"`
+	CreatedAt  time.Time             `db:"created_at" json:"createdAt"`
+	UpdatedAt  time.Time             `db:"updated_at" json:"updatedAt"`
+}
+
+// QuietWindow is a daily period given as "HH:MM" clock times. A window ending before it starts
+// spans midnight, e.g. 22:00 to 07:00.
+type QuietWindow struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// ContactFor returns the contact point of the recipient for a channel
+func (r *Recipient) ContactFor(channel NotificationChannel) (string, bool) {
+	var contact *string
+	switch channel {
+	case ChannelSMS:
+		contact = r.Phone
+	case ChannelEmail:
+		contact = r.Email
+	case ChannelSlack:
+		contact = r.SlackChannel
+	}
+	if contact == nil || *contact == "" {
+		return "", false
+	}
+	return *contact, true
+}
+
+// Suppression stops notifications on a channel to a recipient, e.g. after they unsubscribed.
+// Without a category all notifications are suppressed, otherwise only the ones with a matching
+// "category" metadata.
+type Suppression struct {
+	ID        string              `db:"id" json:"id"`
+	Channel   NotificationChannel `db:"channel" json:"channel"`
+	Recipient string              `db:"recipient" json:"recipient"`
+	Category  *string             `db:"category" json:"category,omitempty"`
+	Reason    string              `db:"reason" json:"reason,omitempty"`
+	CreatedAt time.Time           `db:"created_at" json:"createdAt"`
+}
+
+// NotificationAttempt is a single try to deliver a notification through its provider
+type NotificationAttempt struct {
+	ID                int64     `db:"id" json:"id"`
+	NotificationID    string    `db:"notification_id" json:"notificationId"`
+	Attempt           int       `db:"attempt" json:"attempt"`
+	Provider          string    `db:"provider" json:"provider"`
+	StartedAt         time.Time `db:"started_at" json:"startedAt"`
+	DurationMs        int64     `db:"duration_ms" json:"durationMs"`
+	Error             *string   `db:"error" json:"error,omitempty"`
+	ProviderMessageID *string   `db:"provider_message_id" json:"providerMessageId,omitempty"`
+}
+
+// WebhookEvent is a status change of a notification posted to its callback URL. Events are stored
+// before they are delivered, and retried with backoff until the receiver accepts them.
+type WebhookEvent struct {
+	ID             int64           `db:"id" json:"id"`
+	NotificationID string          `db:"notification_id" json:"notificationId"`
+	Event          string          `db:"event" json:"event"`
+	URL            string          `db:"url" json:"url"`
+	Payload        json.RawMessage `db:"payload" json:"payload"`
+	Attempts       int             `db:"attempts" json:"attempts"`
+	NextAttemptAt  time.Time       `db:"next_attempt_at" json:"nextAttemptAt"`
+	DeliveredAt    *time.Time      `db:"delivered_at" json:"deliveredAt,omitempty"`
+	LastError      *string         `db:"last_error" json:"lastError,omitempty"`
+	CreatedAt      time.Time       `db:"created_at" json:"createdAt"`
+	// DeliveryAttempts is only filled in when listing the webhook events of a notification
+	DeliveryAttempts []WebhookAttempt `db:"-" json:"deliveryAttempts,omitempty"`
+}
+
+// WebhookAttempt is a single try to post a webhook event to its callback URL
+type WebhookAttempt struct {
+	ID          int64     `db:"id" json:"id"`
+	EventID     int64     `db:"event_id" json:"eventId"`
+	AttemptedAt time.Time `db:"attempted_at" json:"attemptedAt"`
+	DurationMs  int64     `db:"duration_ms" json:"durationMs"`
+	StatusCode  *int      `db:"status_code" json:"statusCode,omitempty"`
+	Error       *string   `db:"error" json:"error,omitempty"`
+}
+
+// APIKey identifies a client calling the API. Only a hash of the key is stored, the key itself is
+// returned once when it is issued.
+type APIKey struct {
+	ID        string     `db:"id" json:"id"`
+	ClientID  string     `db:"client_id" json:"clientId"`
+	Name      string     `db:"name" json:"name,omitempty"`
+	Prefix    string     `db:"key_prefix" json:"prefix"`
+	CreatedAt time.Time  `db:"created_at" json:"createdAt"`
+	// ExpiresAt is set on keys replaced by a rotation, which keep working for a grace period
+	ExpiresAt *time.Time `db:"expires_at" json:"expiresAt,omitempty"`
+	RevokedAt *time.Time `db:"revoked_at" json:"revokedAt,omitempty"`
+	Key       string     `db:"-" json:"key,omitempty"`
+}
+
+// RateLimitRejection records a request or notification rejected by a rate limit
+type RateLimitRejection struct {
+	ID           int64                `db:"id" json:"id"`
+	ClientID     *string              `db:"client_id" json:"clientId,omitempty"`
+	LimitType    string               `db:"limit_type" json:"limitType"`
+	Key          string               `db:"key" json:"key"`
+	Channel      *NotificationChannel `db:"channel" json:"channel,omitempty"`
+	RetryAfterMs int64                `db:"retry_after_ms" json:"retryAfterMs"`
+	CreatedAt    time.Time            `db:"created_at" json:"createdAt"`
 }
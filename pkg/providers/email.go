@@ -4,9 +4,13 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"notification-system/pkg/config"
 	"notification-system/pkg/model"
+	"strconv"
+	"time"
 
+	"github.com/sendgrid/rest"
 	"github.com/sendgrid/sendgrid-go"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
 )
@@ -28,9 +32,13 @@ func NewEmailNotificationProvider(cfg config.EmailConfig) *EmailNotificationProv
 	}
 }
 
-func (e *EmailNotificationProvider) Send(ctx context.Context, notification model.Notification) error {
+func (e *EmailNotificationProvider) Name() string {
+	return "sendgrid"
+}
+
+func (e *EmailNotificationProvider) Send(ctx context.Context, notification model.Notification) (DeliveryResult, error) {
 	// Create a channel to receive the result
-	result := make(chan error, 1)
+	result := make(chan emailResult, 1)
 
 	// Start the send operation in a goroutine
 	go func() {
@@ -43,29 +51,35 @@ func (e *EmailNotificationProvider) Send(ctx context.Context, notification model
 			subject = defaultEmailSubject // Fallback to hardcoded default if not configured
 		}
 		if notification.Metadata != nil {
-			if emailSubject, ok := notification.Metadata["email_subject"]; ok {
+			if emailSubject, ok := notification.Metadata[model.MetadataEmailSubject]; ok {
 				subject = emailSubject
 			}
 		}
 
 		plainTextContent := notification.Message
 		htmlContent := fmt.Sprintf("<p>%s</p>", notification.Message)
+		// Use the HTML body rendered from a template when there is one
+		if html, ok := notification.Metadata[model.MetadataEmailHTML]; ok {
+			htmlContent = html
+		}
 
 		message := mail.NewSingleEmail(from, subject, to, plainTextContent, htmlContent)
 
 		response, err := e.client.SendWithContext(ctx, message)
 		if err != nil {
-			result <- fmt.Errorf("failed to send email: %w", err)
+			result <- emailResult{err: &TransientError{Err: fmt.Errorf("failed to send email: %w", err)}}
 			return
 		}
 
 		if response.StatusCode >= 300 {
-			result <- fmt.Errorf("sendgrid API error: %d - %s", response.StatusCode, response.Body)
+			result <- emailResult{err: sendgridError(response)}
 			return
 		}
 
+		// Event webhooks refer to the message by this ID
+		messageID := http.Header(response.Headers).Get("X-Message-Id")
 		select {
-		case result <- nil:
+		case result <- emailResult{messageID: messageID}:
 			// Successfully sent result
 		case <-ctx.Done():
 			// Context was cancelled, discard the result
@@ -74,13 +88,34 @@ func (e *EmailNotificationProvider) Send(ctx context.Context, notification model
 
 	// Wait for either the operation to complete or the context to be done
 	select {
-	case err := <-result:
-		if err != nil {
-			return err
+	case res := <-result:
+		if res.err != nil {
+			return DeliveryResult{}, res.err
 		}
 		log.Printf("Email sent successfully to %s: %s", notification.Recipient, notification.Message)
-		return nil
+		return DeliveryResult{ProviderMessageID: res.messageID}, nil
 	case <-ctx.Done():
-		return fmt.Errorf("email send operation cancelled: %w", ctx.Err())
+		return DeliveryResult{}, &TransientError{Err: fmt.Errorf("email send operation cancelled: %w", ctx.Err())}
+	}
+}
+
+// emailResult is the outcome of a SendGrid request
+type emailResult struct {
+	messageID string
+	err       error
+}
+
+// sendgridError classifies a failed SendGrid response by its status. Rate limited responses carry
+// the time the limit resets as a Unix timestamp.
+func sendgridError(response *rest.Response) error {
+	err := fmt.Errorf("sendgrid API error: %d - %s", response.StatusCode, response.Body)
+
+	headers := http.Header(response.Headers)
+	now := time.Now()
+	retryAfter := parseRetryAfter(headers.Get("Retry-After"), now)
+	if reset, convErr := strconv.ParseInt(headers.Get("X-RateLimit-Reset"), 10, 64); retryAfter == 0 && convErr == nil {
+		retryAfter = max(time.Unix(reset, 0).Sub(now), 0)
 	}
-}
\ No newline at end of file
+
+	return classifyStatus(response.StatusCode, retryAfter, err)
+}
@@ -0,0 +1,98 @@
+package providers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// PermanentError is a failure that will not go away by retrying, e.g. an invalid recipient
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// TransientError is a failure that may succeed when retried, e.g. a timeout or a provider outage.
+// Errors that are not classified are treated as transient as well.
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string { return e.Err.Error() }
+func (e *TransientError) Unwrap() error { return e.Err }
+
+// RateLimitedError is returned when the provider throttles requests. RetryAfter is the wait time
+// asked for by the provider, zero if it did not give one.
+type RateLimitedError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitedError) Error() string { return e.Err.Error() }
+func (e *RateLimitedError) Unwrap() error { return e.Err }
+
+// ThrottledError is returned when a send was held back by the throughput limits of the provider
+// before reaching it, so it does not count as an attempt. RetryAfter is when to try again.
+type ThrottledError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string { return e.Err.Error() }
+func (e *ThrottledError) Unwrap() error { return e.Err }
+
+// IsPermanent reports whether retrying the failed send is pointless
+func IsPermanent(err error) bool {
+	var permanent *PermanentError
+	return errors.As(err, &permanent)
+}
+
+// RetryAfter returns the wait time asked for by a rate limiting provider
+func RetryAfter(err error) (time.Duration, bool) {
+	var rateLimited *RateLimitedError
+	if errors.As(err, &rateLimited) && rateLimited.RetryAfter > 0 {
+		return rateLimited.RetryAfter, true
+	}
+	return 0, false
+}
+
+// IsThrottled reports whether a send was held back by the throughput limits and when to try again
+func IsThrottled(err error) (time.Duration, bool) {
+	var throttled *ThrottledError
+	if errors.As(err, &throttled) {
+		return throttled.RetryAfter, true
+	}
+	return 0, false
+}
+
+// classifyStatus maps the HTTP status of a failed provider request to a typed error. Client errors
+// are permanent, except for timeouts and rate limits.
+func classifyStatus(status int, retryAfter time.Duration, err error) error {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return &RateLimitedError{Err: err, RetryAfter: retryAfter}
+	case status == http.StatusRequestTimeout:
+		return &TransientError{Err: err}
+	case status >= 400 && status < 500:
+		return &PermanentError{Err: err}
+	default:
+		return &TransientError{Err: err}
+	}
+}
+
+// parseRetryAfter returns the wait time of a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,92 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sendgrid/rest"
+	"github.com/slack-go/slack"
+	"github.com/twilio/twilio-go/client"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Provider errors", func() {
+	Describe("Twilio", func() {
+		It("should treat an invalid phone number as permanent", func() {
+			err := twilioError(fmt.Errorf("failed to send SMS: %w", &client.TwilioRestError{Status: 400, Code: 21211}))
+			Expect(IsPermanent(err)).To(BeTrue())
+		})
+
+		It("should treat rate limits as rate limited", func() {
+			err := twilioError(&client.TwilioRestError{Status: 429, Code: 20429})
+			var rateLimited *RateLimitedError
+			Expect(errors.As(err, &rateLimited)).To(BeTrue())
+			Expect(IsPermanent(err)).To(BeFalse())
+		})
+
+		It("should treat errors without a response as transient", func() {
+			err := twilioError(errors.New("connection reset by peer"))
+			Expect(IsPermanent(err)).To(BeFalse())
+		})
+	})
+
+	Describe("SendGrid", func() {
+		It("should treat a bad request as permanent", func() {
+			err := sendgridError(&rest.Response{StatusCode: 400, Body: "invalid email"})
+			Expect(IsPermanent(err)).To(BeTrue())
+		})
+
+		It("should treat server errors as transient", func() {
+			err := sendgridError(&rest.Response{StatusCode: 503})
+			Expect(IsPermanent(err)).To(BeFalse())
+		})
+
+		It("should honor the Retry-After header", func() {
+			err := sendgridError(&rest.Response{
+				StatusCode: 429,
+				Headers:    map[string][]string{"Retry-After": {"30"}},
+			})
+			retryAfter, ok := RetryAfter(err)
+			Expect(ok).To(BeTrue())
+			Expect(retryAfter).To(Equal(30 * time.Second))
+		})
+
+		It("should wait until the rate limit resets", func() {
+			reset := time.Now().Add(time.Minute).Unix()
+			err := sendgridError(&rest.Response{
+				StatusCode: 429,
+				Headers:    map[string][]string{"X-Ratelimit-Reset": {fmt.Sprint(reset)}},
+			})
+			retryAfter, ok := RetryAfter(err)
+			Expect(ok).To(BeTrue())
+			Expect(retryAfter).To(BeNumerically("~", time.Minute, 2*time.Second))
+		})
+	})
+
+	Describe("Slack", func() {
+		It("should treat an unknown channel as permanent", func() {
+			err := slackError(fmt.Errorf("failed to send Slack message: %w", slack.SlackErrorResponse{Err: "channel_not_found"}))
+			Expect(IsPermanent(err)).To(BeTrue())
+		})
+
+		It("should honor the retry-after of rate limits", func() {
+			err := slackError(&slack.RateLimitedError{RetryAfter: 5 * time.Second})
+			retryAfter, ok := RetryAfter(err)
+			Expect(ok).To(BeTrue())
+			Expect(retryAfter).To(Equal(5 * time.Second))
+		})
+
+		It("should treat internal errors as transient", func() {
+			err := slackError(slack.SlackErrorResponse{Err: "internal_error"})
+			Expect(IsPermanent(err)).To(BeFalse())
+		})
+
+		It("should keep errors that are already classified", func() {
+			err := slackError(&PermanentError{Err: errors.New("invalid Slack blocks")})
+			Expect(IsPermanent(err)).To(BeTrue())
+		})
+	})
+})
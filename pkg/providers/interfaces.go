@@ -5,9 +5,17 @@ import (
 	"notification-system/pkg/model"
 )
 
+// DeliveryResult describes a notification accepted by a provider
+type DeliveryResult struct {
+	// ProviderMessageID identifies the message at the provider, delivery receipts refer to it
+	ProviderMessageID string
+}
+
 // NotificationProvider defines the interface for sending notifications
 type NotificationProvider interface {
-	Send(ctx context.Context, notification model.Notification) error
+	Send(ctx context.Context, notification model.Notification) (DeliveryResult, error)
+	// Name identifies the provider in the delivery history
+	Name() string
 }
 
 // SMSProvider defines the interface for SMS notifications
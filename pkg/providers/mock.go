@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"notification-system/pkg/model"
 	"sync"
+
+	"github.com/google/uuid"
 )
 
 // MockSMSProvider implements SMSProvider for testing
@@ -20,17 +22,21 @@ func NewMockSMSProvider() *MockSMSProvider {
 	}
 }
 
-func (m *MockSMSProvider) Send(ctx context.Context, notification model.Notification) error {
+func (m *MockSMSProvider) Name() string {
+	return "mock-sms"
+}
+
+func (m *MockSMSProvider) Send(ctx context.Context, notification model.Notification) (DeliveryResult, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	if m.FailNext {
 		m.FailNext = false
-		return fmt.Errorf("mock SMS provider failure")
+		return DeliveryResult{}, fmt.Errorf("mock SMS provider failure")
 	}
 
 	m.sent = append(m.sent, notification)
-	return nil
+	return DeliveryResult{ProviderMessageID: uuid.New().String()}, nil
 }
 
 func (m *MockSMSProvider) GetSent() []model.Notification {
@@ -59,17 +65,21 @@ func NewMockEmailProvider() *MockEmailProvider {
 	}
 }
 
-func (m *MockEmailProvider) Send(ctx context.Context, notification model.Notification) error {
+func (m *MockEmailProvider) Name() string {
+	return "mock-email"
+}
+
+func (m *MockEmailProvider) Send(ctx context.Context, notification model.Notification) (DeliveryResult, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	if m.FailNext {
 		m.FailNext = false
-		return fmt.Errorf("mock email provider failure")
+		return DeliveryResult{}, fmt.Errorf("mock email provider failure")
 	}
 
 	m.sent = append(m.sent, notification)
-	return nil
+	return DeliveryResult{ProviderMessageID: uuid.New().String()}, nil
 }
 
 func (m *MockEmailProvider) GetSent() []model.Notification {
@@ -98,17 +108,21 @@ func NewMockSlackProvider() *MockSlackProvider {
 	}
 }
 
-func (m *MockSlackProvider) Send(ctx context.Context, notification model.Notification) error {
+func (m *MockSlackProvider) Name() string {
+	return "mock-slack"
+}
+
+func (m *MockSlackProvider) Send(ctx context.Context, notification model.Notification) (DeliveryResult, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	if m.FailNext {
 		m.FailNext = false
-		return fmt.Errorf("mock Slack provider failure")
+		return DeliveryResult{}, fmt.Errorf("mock Slack provider failure")
 	}
 
 	m.sent = append(m.sent, notification)
-	return nil
+	return DeliveryResult{ProviderMessageID: uuid.New().String()}, nil
 }
 
 func (m *MockSlackProvider) GetSent() []model.Notification {
@@ -2,6 +2,8 @@ package providers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"notification-system/pkg/config"
@@ -10,6 +12,24 @@ import (
 	"github.com/slack-go/slack"
 )
 
+// permanentSlackErrors are the Slack API error codes that fail the same way when retried
+var permanentSlackErrors = map[string]bool{
+	"channel_not_found":       true,
+	"not_in_channel":          true,
+	"is_archived":             true,
+	"msg_too_long":            true,
+	"no_text":                 true,
+	"invalid_blocks":          true,
+	"invalid_blocks_format":   true,
+	"restricted_action":       true,
+	"cannot_reply_to_message": true,
+	"not_authed":              true,
+	"invalid_auth":            true,
+	"account_inactive":        true,
+	"token_revoked":           true,
+	"missing_scope":           true,
+}
+
 type SlackNotificationProvider struct {
 	client *slack.Client
 }
@@ -21,20 +41,37 @@ func NewSlackNotificationProvider(cfg config.SlackConfig) *SlackNotificationProv
 	}
 }
 
-func (s *SlackNotificationProvider) Send(ctx context.Context, notification model.Notification) error {
+func (s *SlackNotificationProvider) Name() string {
+	return "slack"
+}
+
+func (s *SlackNotificationProvider) Send(ctx context.Context, notification model.Notification) (DeliveryResult, error) {
 	// Create a channel to receive the result
-	result := make(chan error, 1)
+	result := make(chan slackResult, 1)
 
 	// Start the send operation in a goroutine
 	go func() {
+		options := []slack.MsgOption{slack.MsgOptionText(notification.Message, false)}
+
+		// Add the blocks rendered from a template, the text is kept as a fallback for notifications
+		if blocksJSON, ok := notification.Metadata[model.MetadataSlackBlocks]; ok {
+			var blocks slack.Blocks
+			if err := json.Unmarshal([]byte(blocksJSON), &blocks); err != nil {
+				result <- slackResult{err: &PermanentError{Err: fmt.Errorf("invalid Slack blocks: %w", err)}}
+				return
+			}
+			options = append(options, slack.MsgOptionBlocks(blocks.BlockSet...))
+		}
+
 		// Send the message to the specified channel
-		_, _, err := s.client.PostMessageContext(
+		// The timestamp identifies the message within the channel
+		_, timestamp, err := s.client.PostMessageContext(
 			ctx,
 			notification.Recipient, // In Slack, recipient is the channel ID
-			slack.MsgOptionText(notification.Message, false),
+			options...,
 		)
 		select {
-		case result <- err:
+		case result <- slackResult{timestamp: timestamp, err: err}:
 			// Successfully sent result
 		case <-ctx.Done():
 			// Context was cancelled, discard the result
@@ -43,13 +80,44 @@ func (s *SlackNotificationProvider) Send(ctx context.Context, notification model
 
 	// Wait for either the operation to complete or the context to be done
 	select {
-	case err := <-result:
-		if err != nil {
-			return fmt.Errorf("failed to send Slack message: %w", err)
+	case res := <-result:
+		if res.err != nil {
+			return DeliveryResult{}, slackError(fmt.Errorf("failed to send Slack message: %w", res.err))
 		}
 		log.Printf("Slack message sent successfully: %s", notification.Message)
-		return nil
+		return DeliveryResult{ProviderMessageID: res.timestamp}, nil
 	case <-ctx.Done():
-		return fmt.Errorf("slack message send operation cancelled: %w", ctx.Err())
+		return DeliveryResult{}, &TransientError{Err: fmt.Errorf("slack message send operation cancelled: %w", ctx.Err())}
+	}
+}
+
+// slackResult is the outcome of a Slack request
+type slackResult struct {
+	timestamp string
+	err       error
+}
+
+// slackError classifies a failed Slack request by the error code or HTTP status of the response
+func slackError(err error) error {
+	var classified *PermanentError
+	if errors.As(err, &classified) {
+		return err
+	}
+
+	var rateLimited *slack.RateLimitedError
+	if errors.As(err, &rateLimited) {
+		return &RateLimitedError{Err: err, RetryAfter: rateLimited.RetryAfter}
+	}
+
+	var slackErr slack.SlackErrorResponse
+	if errors.As(err, &slackErr) && permanentSlackErrors[slackErr.Err] {
+		return &PermanentError{Err: err}
+	}
+
+	var statusErr slack.StatusCodeError
+	if errors.As(err, &statusErr) {
+		return classifyStatus(statusErr.Code, 0, err)
 	}
-}
\ No newline at end of file
+
+	return &TransientError{Err: err}
+}
@@ -2,18 +2,22 @@ package providers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"notification-system/pkg/config"
 	"notification-system/pkg/model"
 
 	"github.com/twilio/twilio-go"
+	"github.com/twilio/twilio-go/client"
 	api "github.com/twilio/twilio-go/rest/api/v2010"
 )
 
 type TwilioSMSProvider struct {
 	client     *twilio.RestClient
 	fromNumber string
+	// statusCallbackURL receives the delivery status updates of sent messages
+	statusCallbackURL string
 }
 
 func NewTwilioSMSProvider(cfg config.TwilioConfig) *TwilioSMSProvider {
@@ -23,14 +27,19 @@ func NewTwilioSMSProvider(cfg config.TwilioConfig) *TwilioSMSProvider {
 	})
 
 	return &TwilioSMSProvider{
-		client:     client,
-		fromNumber: cfg.FromNumber,
+		client:            client,
+		fromNumber:        cfg.FromNumber,
+		statusCallbackURL: cfg.StatusCallbackURL,
 	}
 }
 
-func (t *TwilioSMSProvider) Send(ctx context.Context, notification model.Notification) error {
+func (t *TwilioSMSProvider) Name() string {
+	return "twilio"
+}
+
+func (t *TwilioSMSProvider) Send(ctx context.Context, notification model.Notification) (DeliveryResult, error) {
 	// Create a channel to receive the result
-	result := make(chan error, 1)
+	result := make(chan smsResult, 1)
 
 	// Start the send operation in a goroutine
 	go func() {
@@ -38,10 +47,17 @@ func (t *TwilioSMSProvider) Send(ctx context.Context, notification model.Notific
 		params.SetTo(notification.Recipient)
 		params.SetFrom(t.fromNumber)
 		params.SetBody(notification.Message)
+		if t.statusCallbackURL != "" {
+			params.SetStatusCallback(t.statusCallbackURL)
+		}
 
-		_, err := t.client.Api.CreateMessage(params)
+		message, err := t.client.Api.CreateMessage(params)
+		var sid string
+		if message != nil && message.Sid != nil {
+			sid = *message.Sid
+		}
 		select {
-		case result <- err:
+		case result <- smsResult{sid: sid, err: err}:
 			// Successfully sent result
 		case <-ctx.Done():
 			// Context was cancelled, discard the result
@@ -50,13 +66,29 @@ func (t *TwilioSMSProvider) Send(ctx context.Context, notification model.Notific
 
 	// Wait for either the operation to complete or the context to be done
 	select {
-	case err := <-result:
-		if err != nil {
-			return fmt.Errorf("failed to send SMS: %w", err)
+	case res := <-result:
+		if res.err != nil {
+			return DeliveryResult{}, twilioError(fmt.Errorf("failed to send SMS: %w", res.err))
 		}
 		log.Printf("SMS sent successfully: %s", notification.Message)
-		return nil
+		return DeliveryResult{ProviderMessageID: res.sid}, nil
 	case <-ctx.Done():
-		return fmt.Errorf("SMS send operation timed out: %w", ctx.Err())
+		return DeliveryResult{}, &TransientError{Err: fmt.Errorf("SMS send operation timed out: %w", ctx.Err())}
+	}
+}
+
+// smsResult is the outcome of a Twilio request, the SID identifies the created message
+type smsResult struct {
+	sid string
+	err error
+}
+
+// twilioError classifies a failed Twilio request by the HTTP status of the API error, e.g. an
+// invalid phone number is permanent. Errors without a response, like network errors, are transient.
+func twilioError(err error) error {
+	var restErr *client.TwilioRestError
+	if errors.As(err, &restErr) {
+		return classifyStatus(restErr.Status, 0, err)
 	}
-}
\ No newline at end of file
+	return &TransientError{Err: err}
+}
@@ -9,6 +9,8 @@ import (
 // NotificationStrategyContext manages the notification sending strategies
 type NotificationStrategyContext struct {
 	strategies map[model.NotificationChannel]NotificationProvider
+	// throttle keeps the sends within the throughput limits of the providers, nil for no limits
+	throttle *Throttle
 }
 
 func NewNotificationStrategyContext() *NotificationStrategyContext {
@@ -22,11 +24,24 @@ func (c *NotificationStrategyContext) RegisterStrategy(channel model.Notificatio
 	c.strategies[channel] = provider
 }
 
+// SetThrottle limits the throughput of the sends to the providers
+func (c *NotificationStrategyContext) SetThrottle(throttle *Throttle) {
+	c.throttle = throttle
+}
+
 // Send uses the appropriate strategy based on the notification channel
-func (c *NotificationStrategyContext) Send(ctx context.Context, notification model.Notification) error {
+func (c *NotificationStrategyContext) Send(ctx context.Context, notification model.Notification) (DeliveryResult, error) {
 	provider, exists := c.strategies[notification.Channel]
 	if !exists {
-		return fmt.Errorf("no provider registered for channel: %s", notification.Channel)
+		return DeliveryResult{}, fmt.Errorf("no provider registered for channel: %s", notification.Channel)
+	}
+
+	if c.throttle != nil {
+		release, err := c.throttle.Wait(ctx, notification.Channel, provider.Name())
+		if err != nil {
+			return DeliveryResult{}, err
+		}
+		defer release()
 	}
 	return provider.Send(ctx, notification)
 }
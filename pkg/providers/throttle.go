@@ -0,0 +1,94 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"notification-system/pkg/config"
+	"notification-system/pkg/model"
+	"notification-system/pkg/ratelimit"
+	"time"
+)
+
+const (
+	// inFlightPollInterval is how long a send waits before checking again for a free in-flight slot
+	inFlightPollInterval = 100 * time.Millisecond
+	// inFlightLeaseMargin keeps the in-flight slot of a send a while past its deadline, after which
+	// a slot left behind by a crashed worker is freed
+	inFlightLeaseMargin = 30 * time.Second
+	// defaultInFlightLease is used for sends without a deadline
+	defaultInFlightLease = time.Minute
+)
+
+// Throttle keeps the sends of every provider within its throughput limits. The limiter and the
+// semaphore decide whether the limits apply per worker or to all workers together.
+type Throttle struct {
+	limiter   ratelimit.Limiter
+	semaphore ratelimit.Semaphore
+	limits    map[model.NotificationChannel]config.ProviderLimitConfig
+}
+
+func NewThrottle(limiter ratelimit.Limiter, semaphore ratelimit.Semaphore, limits map[model.NotificationChannel]config.ProviderLimitConfig) *Throttle {
+	return &Throttle{
+		limiter:   limiter,
+		semaphore: semaphore,
+		limits:    limits,
+	}
+}
+
+// Wait blocks until the provider of the channel can take another send and returns a function to
+// call once the send is done. If the send would have to wait past the deadline of the context, it
+// returns a ThrottledError instead. Failures of the limiter are only logged, so sending goes on
+// without limits rather than stopping.
+func (t *Throttle) Wait(ctx context.Context, channel model.NotificationChannel, provider string) (func(), error) {
+	limits := t.limits[channel]
+	rate := ratelimit.Limit{Rate: limits.RequestsPerSecond, Burst: limits.Burst}
+	if rate.Burst <= 0 {
+		rate.Burst = int(math.Ceil(rate.Rate))
+	}
+	if !rate.Enabled() && limits.MaxInFlight <= 0 {
+		return func() {}, nil
+	}
+
+	key := "provider:" + provider
+	for {
+		release, ok, err := t.semaphore.Acquire(ctx, key, limits.MaxInFlight, inFlightLease(ctx))
+		if err != nil {
+			log.Printf("Failed to check in-flight limit of provider %s: %v", provider, err)
+			return func() {}, nil
+		}
+
+		wait := inFlightPollInterval
+		if ok {
+			allowed, tokenWait, err := t.limiter.Allow(ctx, key, rate, 1)
+			if err != nil {
+				log.Printf("Failed to check rate limit of provider %s: %v", provider, err)
+				return release, nil
+			}
+			if allowed {
+				return release, nil
+			}
+			// Free the slot for others while waiting for the rate limit
+			release()
+			wait = tokenWait
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return nil, &ThrottledError{Err: fmt.Errorf("provider %s is at its throughput limit", provider), RetryAfter: wait}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, &ThrottledError{Err: fmt.Errorf("provider %s is at its throughput limit: %w", provider, ctx.Err()), RetryAfter: wait}
+		case <-time.After(wait):
+		}
+	}
+}
+
+// inFlightLease returns how long an in-flight slot is held at most
+func inFlightLease(ctx context.Context) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		return time.Until(deadline) + inFlightLeaseMargin
+	}
+	return defaultInFlightLease
+}
@@ -0,0 +1,73 @@
+package providers
+
+import (
+	"context"
+	"notification-system/pkg/config"
+	"notification-system/pkg/model"
+	"notification-system/pkg/ratelimit"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Throttle", func() {
+	newThrottle := func(limits config.ProviderLimitConfig) *Throttle {
+		return NewThrottle(ratelimit.NewMemoryLimiter(), ratelimit.NewMemorySemaphore(), map[model.NotificationChannel]config.ProviderLimitConfig{
+			model.ChannelSMS: limits,
+		})
+	}
+
+	It("should not hold back channels without limits", func() {
+		throttle := newThrottle(config.ProviderLimitConfig{RequestsPerSecond: 1})
+		for i := 0; i < 5; i++ {
+			release, err := throttle.Wait(context.Background(), model.ChannelEmail, "mock-email")
+			Expect(err).NotTo(HaveOccurred())
+			release()
+		}
+	})
+
+	It("should hold back sends over the rate until the deadline", func() {
+		throttle := newThrottle(config.ProviderLimitConfig{RequestsPerSecond: 1, Burst: 1})
+		release, err := throttle.Wait(context.Background(), model.ChannelSMS, "mock-sms")
+		Expect(err).NotTo(HaveOccurred())
+		release()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err = throttle.Wait(ctx, model.ChannelSMS, "mock-sms")
+		retryAfter, throttled := IsThrottled(err)
+		Expect(throttled).To(BeTrue())
+		Expect(retryAfter).To(BeNumerically(">", 800*time.Millisecond))
+		Expect(IsPermanent(err)).To(BeFalse())
+	})
+
+	It("should wait for a free in-flight slot", func() {
+		throttle := newThrottle(config.ProviderLimitConfig{MaxInFlight: 1})
+		release, err := throttle.Wait(context.Background(), model.ChannelSMS, "mock-sms")
+		Expect(err).NotTo(HaveOccurred())
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			release()
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		next, err := throttle.Wait(ctx, model.ChannelSMS, "mock-sms")
+		Expect(err).NotTo(HaveOccurred())
+		next()
+	})
+
+	It("should give up when no in-flight slot frees up in time", func() {
+		throttle := newThrottle(config.ProviderLimitConfig{MaxInFlight: 1})
+		_, err := throttle.Wait(context.Background(), model.ChannelSMS, "mock-sms")
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+		defer cancel()
+		_, err = throttle.Wait(ctx, model.ChannelSMS, "mock-sms")
+		_, throttled := IsThrottled(err)
+		Expect(throttled).To(BeTrue())
+	})
+})
@@ -2,9 +2,12 @@ package queue
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"notification-system/pkg/config"
 	"notification-system/pkg/model"
+	"sync"
+	"time"
 
 	"github.com/streadway/amqp"
 )
@@ -12,11 +15,47 @@ import (
 const (
 	exchangeName = "notifications"
 	dlqExchangeName = "notifications.dlq"
+
+	// publishWindow is the maximum number of published messages waiting for a broker confirmation
+	publishWindow = 256
+
+	// maxPriority is the highest message priority of the channel queues
+	maxPriority = 3
+	// defaultPrefetch is the number of unacknowledged messages delivered to a consumer when none is
+	// configured. It is kept low, so urgent messages arriving later are not stuck behind a large
+	// prefetched backlog.
+	defaultPrefetch = 1
+
+	// attemptHeader carries the number of failed delivery attempts of a retried message
+	attemptHeader = "attempt"
 )
 
+// priorityLevels maps notification priorities to message priorities, urgent messages are delivered first
+var priorityLevels = map[model.NotificationPriority]uint8{
+	model.PriorityLow:      0,
+	model.PriorityNormal:   1,
+	model.PriorityHigh:     2,
+	model.PriorityCritical: maxPriority,
+}
+
 type QueueClient struct {
+	conn     *amqp.Connection
+	channel  *amqp.Channel
+	config   config.RabbitMQConfig
+	confirms chan amqp.Confirmation
+	// publishMu serializes publishing, so every publish is matched with its own broker confirmation
+	publishMu sync.Mutex
+	// retryDelays holds the delays with a declared retry queue
+	retryDelays map[time.Duration]bool
+
+	consumersMu sync.Mutex
+	consumers   []consumer
+}
+
+// consumer is a consumer started by Consume on its own AMQP channel
+type consumer struct {
 	channel *amqp.Channel
-	config  config.RabbitMQConfig
+	tag     string
 }
 
 func NewQueueClient(cfg config.RabbitMQConfig) (*QueueClient, error) {
@@ -30,6 +69,12 @@ func NewQueueClient(cfg config.RabbitMQConfig) (*QueueClient, error) {
 		return nil, fmt.Errorf("failed to open channel: %w", err)
 	}
 
+	// Enable publisher confirms, so a publish only succeeds once the broker has taken over the message
+	if err := ch.Confirm(false); err != nil {
+		return nil, fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation, publishWindow))
+
 	// Declare the main exchange
 	err = ch.ExchangeDeclare(
 		exchangeName, // exchange name
@@ -60,9 +105,9 @@ func NewQueueClient(cfg config.RabbitMQConfig) (*QueueClient, error) {
 
 	// Declare all channel-specific queues
 	for channel, queueName := range cfg.ChannelQueues {
-		// Declare the main queue
+		// Declare the main queue, a priority queue with a name of its own
 		_, err = ch.QueueDeclare(
-			queueName,
+			priorityQueueName(queueName),
 			true,  // durable
 			false, // delete when unused
 			false, // exclusive
@@ -70,6 +115,7 @@ func NewQueueClient(cfg config.RabbitMQConfig) (*QueueClient, error) {
 			amqp.Table{
 				"x-dead-letter-exchange": dlqExchangeName,
 				"x-dead-letter-routing-key": queueName + ".dlq",
+				"x-max-priority": int32(maxPriority),
 			},
 		)
 		if err != nil {
@@ -92,11 +138,11 @@ func NewQueueClient(cfg config.RabbitMQConfig) (*QueueClient, error) {
 
 		// Bind main queue to main exchange
 		err = ch.QueueBind(
-			queueName,      // queue name
-			string(channel), // routing key
-			exchangeName,   // exchange
-			false,          // no-wait
-			nil,            // arguments
+			priorityQueueName(queueName), // queue name
+			string(channel),              // routing key
+			exchangeName,                 // exchange
+			false,                        // no-wait
+			nil,                          // arguments
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to bind queue for channel %s: %w", channel, err)
@@ -114,59 +160,360 @@ func NewQueueClient(cfg config.RabbitMQConfig) (*QueueClient, error) {
 			return nil, fmt.Errorf("failed to bind DLQ queue for channel %s: %w", channel, err)
 		}
 
-		fmt.Printf("Declared and bound queues for channel %s: %s (main) and %s (DLQ)\n", channel, queueName, dlqQueueName)
+		fmt.Printf("Declared and bound queues for channel %s: %s (main) and %s (DLQ)\n", channel, priorityQueueName(queueName), dlqQueueName)
+	}
+
+	q := &QueueClient{
+		conn:     conn,
+		channel:  ch,
+		config:   cfg,
+		confirms: confirms,
+	}
+
+	for channel, queueName := range cfg.ChannelQueues {
+		if err := q.drainLegacyQueue(channel, queueName); err != nil {
+			return nil, err
+		}
 	}
 
-	return &QueueClient{
-		channel: ch,
-		config:  cfg,
-	}, nil
+	return q, nil
 }
 
-func (q *QueueClient) Publish(msg model.Notification) error {
-	body, err := json.Marshal(msg)
+// drainLegacyQueue moves the messages of a channel queue declared by an older version without
+// x-max-priority into the priority queue of the channel, and then deletes it. RabbitMQ does not
+// allow changing the arguments of an existing queue, which is why the priority queue has a name of
+// its own. The messages were already taken out of the outbox, so they must not get lost.
+func (q *QueueClient) drainLegacyQueue(channel model.NotificationChannel, queueName string) error {
+	// Declaring a missing queue passively closes the channel, so it gets one of its own
+	ch, err := q.conn.Channel()
 	if err != nil {
-		return fmt.Errorf("failed to marshal message: %w", err)
+		return fmt.Errorf("failed to open channel: %w", err)
+	}
+	defer ch.Close()
+
+	if _, err := ch.QueueDeclarePassive(queueName, true, false, false, false, nil); err != nil {
+		var amqpErr *amqp.Error
+		if errors.As(err, &amqpErr) && amqpErr.Code == amqp.NotFound {
+			return nil
+		}
+		return fmt.Errorf("failed to check legacy queue of channel %s: %w", channel, err)
+	}
+
+	// New messages only reach the priority queue from now on
+	if err := ch.QueueUnbind(queueName, string(channel), exchangeName, nil); err != nil {
+		return fmt.Errorf("failed to unbind legacy queue of channel %s: %w", channel, err)
+	}
+
+	moved := 0
+	for {
+		delivery, ok, err := ch.Get(queueName, false)
+		if err != nil {
+			return fmt.Errorf("failed to get message from legacy queue of channel %s: %w", channel, err)
+		}
+		if !ok {
+			break
+		}
+
+		if err := q.republish(delivery, priorityQueueName(queueName)); err != nil {
+			delivery.Nack(false, true)
+			return fmt.Errorf("failed to move message of legacy queue of channel %s: %w", channel, err)
+		}
+		if err := delivery.Ack(false); err != nil {
+			return fmt.Errorf("failed to remove message from legacy queue of channel %s: %w", channel, err)
+		}
+		moved++
+	}
+
+	// A queue that got new messages in the meantime is drained again on the next start
+	if _, err := ch.QueueDelete(queueName, false, true, false); err != nil {
+		return fmt.Errorf("failed to delete legacy queue of channel %s: %w", channel, err)
+	}
+	fmt.Printf("Moved %d messages from legacy queue %s to %s and deleted it\n", moved, queueName, priorityQueueName(queueName))
+	return nil
+}
+
+// republish publishes a delivered message as it is to a queue and waits for its confirmation. The
+// message priority is taken from the notification, since older versions did not set one.
+func (q *QueueClient) republish(delivery amqp.Delivery, queueName string) error {
+	priority := delivery.Priority
+	var notification model.Notification
+	if err := json.Unmarshal(delivery.Body, &notification); err == nil {
+		priority = priorityLevel(notification.Priority)
+	}
+
+	q.publishMu.Lock()
+	defer q.publishMu.Unlock()
+
+	// Queues are addressed directly through the default exchange
+	err := q.channel.Publish("", queueName, false, false, amqp.Publishing{
+		Headers:      delivery.Headers,
+		ContentType:  delivery.ContentType,
+		Body:         delivery.Body,
+		DeliveryMode: amqp.Persistent,
+		Priority:     priority,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+	return q.waitConfirm()
+}
+
+func (q *QueueClient) Publish(msg model.Notification) error {
+	return q.PublishBatch([]model.Notification{msg})[0]
+}
+
+// PublishBatch publishes messages without waiting for each broker confirmation before sending the
+// next one. Confirmations are collected for up to publishWindow messages at a time. It returns one
+// error per message, nil for the ones confirmed by the broker.
+func (q *QueueClient) PublishBatch(msgs []model.Notification) []error {
+	errs := make([]error, len(msgs))
+
+	q.publishMu.Lock()
+	defer q.publishMu.Unlock()
+
+	for start := 0; start < len(msgs); start += publishWindow {
+		end := min(start+publishWindow, len(msgs))
+
+		// Indexes of the messages waiting for a confirmation, in publishing order
+		var pending []int
+		for i := start; i < end; i++ {
+			if errs[i] = q.publish(msgs[i]); errs[i] == nil {
+				pending = append(pending, i)
+			}
+		}
+
+		for _, i := range pending {
+			errs[i] = q.waitConfirm()
+		}
+	}
+
+	return errs
+}
+
+// DeclareRetryQueues declares a retry queue per delay for every channel queue. Messages wait in a
+// retry queue until their TTL expires and are then dead-lettered back to the main exchange.
+// Queues are named after their delay, so changing the retry configuration declares new ones.
+func (q *QueueClient) DeclareRetryQueues(delays []time.Duration) error {
+	// The channel is shared with publishing and does not take concurrent requests
+	q.publishMu.Lock()
+	defer q.publishMu.Unlock()
+
+	if q.retryDelays == nil {
+		q.retryDelays = make(map[time.Duration]bool)
+	}
+	for channel, queueName := range q.config.ChannelQueues {
+		for _, delay := range delays {
+			_, err := q.channel.QueueDeclare(
+				retryQueueName(queueName, delay),
+				true,  // durable
+				false, // delete when unused
+				false, // exclusive
+				false, // no-wait
+				amqp.Table{
+					"x-message-ttl":             int32(delay.Milliseconds()),
+					"x-dead-letter-exchange":    exchangeName,
+					"x-dead-letter-routing-key": string(channel),
+				},
+			)
+			if err != nil {
+				return fmt.Errorf("failed to declare retry queue for channel %s: %w", channel, err)
+			}
+		}
+	}
+
+	for _, delay := range delays {
+		q.retryDelays[delay] = true
+	}
+	return nil
+}
+
+// PublishRetry publishes a message to the retry queue of its channel with the given delay. The
+// message returns to its channel queue after the delay, carrying the attempt number in its headers.
+// Only delays declared with DeclareRetryQueues are accepted, so the number of queues stays fixed.
+func (q *QueueClient) PublishRetry(msg model.Notification, attempt int, delay time.Duration) error {
+	queueName, ok := q.config.ChannelQueues[msg.Channel]
+	if !ok {
+		return fmt.Errorf("no queue configured for channel: %s", msg.Channel)
+	}
+
+	q.publishMu.Lock()
+	defer q.publishMu.Unlock()
+
+	if !q.retryDelays[delay] {
+		return fmt.Errorf("no retry queue declared for delay %s", delay)
+	}
+
+	// Retry queues are addressed directly through the default exchange
+	headers := amqp.Table{attemptHeader: int32(attempt)}
+	if err := q.publishTo("", retryQueueName(queueName, delay), msg, headers); err != nil {
+		return err
 	}
+	return q.waitConfirm()
+}
+
+// Attempt returns the number of failed delivery attempts of a message, 0 for new messages
+func Attempt(delivery amqp.Delivery) int {
+	switch attempt := delivery.Headers[attemptHeader].(type) {
+	case int32:
+		return int(attempt)
+	case int64:
+		return int(attempt)
+	case int16:
+		return int(attempt)
+	case int8:
+		return int(attempt)
+	default:
+		return 0
+	}
+}
 
+// publish sends a single message to the queue of its channel without waiting for its confirmation.
+// Callers must hold publishMu.
+func (q *QueueClient) publish(msg model.Notification) error {
 	// Verify channel is configured
 	if _, ok := q.config.ChannelQueues[msg.Channel]; !ok {
 		return fmt.Errorf("no queue configured for channel: %s", msg.Channel)
 	}
 
-	return q.channel.Publish(
-		exchangeName, // exchange
-		string(msg.Channel), // routing key
-		false,          // mandatory
-		false,          // immediate
+	return q.publishTo(exchangeName, string(msg.Channel), msg, nil)
+}
+
+// publishTo sends a single message without waiting for its confirmation. Callers must hold publishMu.
+func (q *QueueClient) publishTo(exchange, routingKey string, msg model.Notification, headers amqp.Table) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	err = q.channel.Publish(
+		exchange,   // exchange
+		routingKey, // routing key
+		false,      // mandatory
+		false,      // immediate
 		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
+			Headers:      headers,
+			ContentType:  "application/json",
+			Body:         body,
 			DeliveryMode: amqp.Persistent, // Make message persistent
+			Priority:     priorityLevel(msg.Priority),
 		},
 	)
+	if err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+	return nil
+}
+
+// waitConfirm waits for the broker confirmation of the oldest unconfirmed message. Callers must
+// hold publishMu.
+func (q *QueueClient) waitConfirm() error {
+	confirmation, ok := <-q.confirms
+	if !ok {
+		return fmt.Errorf("channel closed before the message was confirmed")
+	}
+	if !confirmation.Ack {
+		return fmt.Errorf("message was not acknowledged by the broker")
+	}
+	return nil
+}
+
+// priorityQueueName returns the name of the priority queue of a channel queue
+func priorityQueueName(queueName string) string {
+	return queueName + ".priority"
+}
+
+func retryQueueName(queueName string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%d", queueName, delay.Milliseconds())
 }
 
-func (q *QueueClient) Consume(channel model.NotificationChannel) (<-chan amqp.Delivery, error) {
+// Consume starts a consumer of the queue of a channel on a dedicated AMQP channel, so every consumer
+// gets its own prefetch. Prefetch is the number of unacknowledged messages delivered to it at once.
+func (q *QueueClient) Consume(channel model.NotificationChannel, prefetch int) (<-chan amqp.Delivery, error) {
 	queueName, ok := q.config.ChannelQueues[channel]
 	if !ok {
 		return nil, fmt.Errorf("no queue configured for channel: %s", channel)
 	}
+	if prefetch <= 0 {
+		prefetch = defaultPrefetch
+	}
+
+	ch, err := q.conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open channel: %w", err)
+	}
+
+	if err := ch.Qos(prefetch, 0, false); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to set prefetch for channel %s: %w", channel, err)
+	}
 
-	return q.channel.Consume(
-		queueName,
-		"",    // consumer
+	q.consumersMu.Lock()
+	defer q.consumersMu.Unlock()
+
+	tag := fmt.Sprintf("%s-%d", queueName, len(q.consumers))
+	deliveries, err := ch.Consume(
+		priorityQueueName(queueName),
+		tag,   // consumer
 		false, // auto-ack
 		false, // exclusive
 		false, // no-local
 		false, // no-wait
 		nil,   // args
 	)
+	if err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to consume queue of channel %s: %w", channel, err)
+	}
+	q.consumers = append(q.consumers, consumer{channel: ch, tag: tag})
+	return deliveries, nil
 }
 
+// StopConsuming stops the delivery of new messages to all consumers. The delivery channels are
+// closed once the messages already on their way have been delivered.
+func (q *QueueClient) StopConsuming() error {
+	q.consumersMu.Lock()
+	defer q.consumersMu.Unlock()
+
+	var errs []error
+	for _, c := range q.consumers {
+		if err := c.channel.Cancel(c.tag, false); err != nil {
+			errs = append(errs, fmt.Errorf("failed to cancel consumer %s: %w", c.tag, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// priorityLevel returns the message priority of a notification priority, normal if it is not set
+func priorityLevel(priority model.NotificationPriority) uint8 {
+	if level, ok := priorityLevels[priority]; ok {
+		return level
+	}
+	return priorityLevels[model.PriorityNormal]
+}
+
+// Close closes the channels and the connection. Messages that are not acknowledged yet go back to
+// their queues.
 func (q *QueueClient) Close() error {
+	var errs []error
+
+	q.consumersMu.Lock()
+	for _, c := range q.consumers {
+		if err := c.channel.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close consumer %s: %w", c.tag, err))
+		}
+	}
+	q.consumers = nil
+	q.consumersMu.Unlock()
+
 	if q.channel != nil {
-		return q.channel.Close()
+		if err := q.channel.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close channel: %w", err))
+		}
 	}
-	return nil
+	if q.conn != nil {
+		if err := q.conn.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close connection: %w", err))
+		}
+	}
+	return errors.Join(errs...)
 }
@@ -0,0 +1,78 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"notification-system/pkg/model"
+
+	"github.com/streadway/amqp"
+)
+
+// DLQAction tells ProcessDLQ what to do with a dead-lettered message
+type DLQAction int
+
+const (
+	// DLQKeep leaves the message in the DLQ
+	DLQKeep DLQAction = iota
+	// DLQRemove removes the message from the DLQ
+	DLQRemove
+)
+
+// MaxDLQBatch is the most messages ProcessDLQ handles at once, since it holds the ones it keeps
+// unacknowledged until it is done
+const MaxDLQBatch = 1000
+
+// ProcessDLQ passes up to limit messages from the DLQ of a channel to handle. The limit must be
+// between 1 and MaxDLQBatch. Messages handle asks to keep, and the ones that cannot be read, are
+// returned to the DLQ once all messages are handled.
+func (q *QueueClient) ProcessDLQ(channel model.NotificationChannel, limit int, handle func(model.Notification) DLQAction) error {
+	queueName, ok := q.config.ChannelQueues[channel]
+	if !ok {
+		return fmt.Errorf("no queue configured for channel: %s", channel)
+	}
+	if limit <= 0 || limit > MaxDLQBatch {
+		return fmt.Errorf("DLQ limit must be between 1 and %d: %d", MaxDLQBatch, limit)
+	}
+
+	// A dedicated channel, so the deliveries held back are not mixed up with publishing
+	ch, err := q.conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open channel: %w", err)
+	}
+	defer ch.Close()
+
+	// Messages kept in the DLQ stay unacknowledged until the end, so they are not fetched again
+	var kept []amqp.Delivery
+	defer func() {
+		for _, delivery := range kept {
+			delivery.Nack(false, true)
+		}
+	}()
+
+	for count := 0; count < limit; count++ {
+		delivery, ok, err := ch.Get(queueName+".dlq", false)
+		if err != nil {
+			return fmt.Errorf("failed to get message from the DLQ of channel %s: %w", channel, err)
+		}
+		if !ok {
+			return nil
+		}
+
+		var notification model.Notification
+		if err := json.Unmarshal(delivery.Body, &notification); err != nil {
+			fmt.Printf("Failed to unmarshal message from the DLQ of channel %s: %v\n", channel, err)
+			kept = append(kept, delivery)
+			continue
+		}
+
+		if handle(notification) == DLQKeep {
+			kept = append(kept, delivery)
+			continue
+		}
+		if err := delivery.Ack(false); err != nil {
+			return fmt.Errorf("failed to remove message from the DLQ of channel %s: %w", channel, err)
+		}
+	}
+
+	return nil
+}
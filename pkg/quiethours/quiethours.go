@@ -0,0 +1,106 @@
+package quiethours
+
+import (
+	"fmt"
+	"notification-system/pkg/model"
+	"time"
+)
+
+// Validate checks that the time zone is known and the windows are valid "HH:MM" clock times
+func Validate(timeZone string, windows []model.QuietWindow) error {
+	if timeZone != "" {
+		if _, err := time.LoadLocation(timeZone); err != nil {
+			return fmt.Errorf("unknown time zone: %s", timeZone)
+		}
+	}
+
+	for i, window := range windows {
+		start, err := parseClock(window.Start)
+		if err != nil {
+			return fmt.Errorf("quiet hours %d: %w", i, err)
+		}
+		end, err := parseClock(window.End)
+		if err != nil {
+			return fmt.Errorf("quiet hours %d: %w", i, err)
+		}
+		if start == end {
+			return fmt.Errorf("quiet hours %d: start and end cannot be equal", i)
+		}
+	}
+
+	return nil
+}
+
+// Location returns the location of an IANA time zone name, UTC when it is empty
+func Location(timeZone string) (*time.Location, error) {
+	if timeZone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(timeZone)
+}
+
+// End returns when the quiet hours covering t end in loc. Windows that overlap or follow each
+// other are treated as one. It returns false if t is outside of the quiet hours.
+func End(windows []model.QuietWindow, loc *time.Location, t time.Time) (time.Time, bool, error) {
+	end := t.In(loc)
+	quiet := false
+
+	// Every window can extend the quiet period at most once
+	for range windows {
+		extended := false
+		for _, window := range windows {
+			windowEnd, covers, err := windowEnd(window, end)
+			if err != nil {
+				return time.Time{}, false, err
+			}
+			if covers && windowEnd.After(end) {
+				end, extended, quiet = windowEnd, true, true
+			}
+		}
+		if !extended {
+			break
+		}
+	}
+
+	return end, quiet, nil
+}
+
+// windowEnd returns the end of the occurrence of a window that covers t, if any. Occurrences
+// starting the day before are checked too, for windows spanning midnight.
+func windowEnd(window model.QuietWindow, t time.Time) (time.Time, bool, error) {
+	start, err := parseClock(window.Start)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	end, err := parseClock(window.End)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	for _, days := range []int{0, -1} {
+		day := t.AddDate(0, 0, days)
+		from := atClock(day, start)
+		to := atClock(day, end)
+		if end <= start {
+			to = atClock(day.AddDate(0, 0, 1), end)
+		}
+		if !t.Before(from) && t.Before(to) {
+			return to, true, nil
+		}
+	}
+	return time.Time{}, false, nil
+}
+
+// parseClock returns the minutes since midnight of a "HH:MM" clock time
+func parseClock(clock string) (int, error) {
+	parsed, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, must be HH:MM", clock)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+// atClock returns the time on the day of t at the given minutes since midnight
+func atClock(t time.Time, minutes int) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), minutes/60, minutes%60, 0, 0, t.Location())
+}
@@ -0,0 +1,13 @@
+package quiethours
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestQuietHours(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Quiet Hours Suite")
+}
@@ -0,0 +1,89 @@
+package quiethours
+
+import (
+	"notification-system/pkg/model"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("End", func() {
+	var (
+		loc     *time.Location
+		windows []model.QuietWindow
+	)
+
+	BeforeEach(func() {
+		var err error
+		loc, err = time.LoadLocation("Europe/Sofia")
+		Expect(err).NotTo(HaveOccurred())
+		windows = []model.QuietWindow{{Start: "22:00", End: "07:00"}}
+	})
+
+	It("should return the end of a window spanning midnight after midnight", func() {
+		end, quiet, err := End(windows, loc, time.Date(2025, 3, 10, 3, 0, 0, 0, loc))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(quiet).To(BeTrue())
+		Expect(end).To(BeTemporally("==", time.Date(2025, 3, 10, 7, 0, 0, 0, loc)))
+	})
+
+	It("should return the end of a window spanning midnight before midnight", func() {
+		end, quiet, err := End(windows, loc, time.Date(2025, 3, 10, 23, 30, 0, 0, loc))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(quiet).To(BeTrue())
+		Expect(end).To(BeTemporally("==", time.Date(2025, 3, 11, 7, 0, 0, 0, loc)))
+	})
+
+	It("should use the time zone of the recipient", func() {
+		// 01:00 UTC is 03:00 in Sofia
+		end, quiet, err := End(windows, loc, time.Date(2025, 3, 10, 1, 0, 0, 0, time.UTC))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(quiet).To(BeTrue())
+		Expect(end).To(BeTemporally("==", time.Date(2025, 3, 10, 5, 0, 0, 0, time.UTC)))
+	})
+
+	It("should not defer outside of the quiet hours", func() {
+		_, quiet, err := End(windows, loc, time.Date(2025, 3, 10, 7, 0, 0, 0, loc))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(quiet).To(BeFalse())
+	})
+
+	It("should merge windows following each other", func() {
+		windows = append(windows, model.QuietWindow{Start: "07:00", End: "08:30"})
+		end, quiet, err := End(windows, loc, time.Date(2025, 3, 10, 23, 0, 0, 0, loc))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(quiet).To(BeTrue())
+		Expect(end).To(BeTemporally("==", time.Date(2025, 3, 11, 8, 30, 0, 0, loc)))
+	})
+
+	It("should not defer without windows", func() {
+		_, quiet, err := End(nil, loc, time.Date(2025, 3, 10, 3, 0, 0, 0, loc))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(quiet).To(BeFalse())
+	})
+})
+
+var _ = Describe("Validate", func() {
+	It("should accept valid windows and time zones", func() {
+		Expect(Validate("America/New_York", []model.QuietWindow{{Start: "22:00", End: "07:00"}})).To(Succeed())
+	})
+
+	It("should reject unknown time zones", func() {
+		err := Validate("Mars/Olympus", nil)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("unknown time zone"))
+	})
+
+	It("should reject invalid clock times", func() {
+		err := Validate("", []model.QuietWindow{{Start: "25:00", End: "07:00"}})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("must be HH:MM"))
+	})
+
+	It("should reject empty windows", func() {
+		err := Validate("", []model.QuietWindow{{Start: "07:00", End: "07:00"}})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("cannot be equal"))
+	})
+})
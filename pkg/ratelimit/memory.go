@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets that refilled completely are dropped from memory
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+// MemoryLimiter keeps the token buckets in memory, so every instance limits on its own
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (m *MemoryLimiter) Allow(ctx context.Context, key string, limit Limit, n int) (bool, time.Duration, error) {
+	if !limit.Enabled() {
+		return true, 0, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		m.buckets[key] = b
+	}
+	b.limit = limit
+
+	left, wait, allowed := limit.Take(b.tokens, now.Sub(b.updated), n)
+	b.tokens, b.updated = left, now
+	return allowed, wait, nil
+}
+
+func (m *MemoryLimiter) Refund(ctx context.Context, key string, limit Limit, n int) error {
+	if !limit.Enabled() {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// A bucket that was dropped is full already
+	if b, ok := m.buckets[key]; ok {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+float64(n))
+	}
+	return nil
+}
+
+// sweep drops the buckets that are full again, they are recreated full when needed
+func (m *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+
+	for key, b := range m.buckets {
+		if tokens, _, _ := b.limit.Take(b.tokens, now.Sub(b.updated), 0); tokens >= float64(b.limit.Burst) {
+			delete(m.buckets, key)
+		}
+	}
+}
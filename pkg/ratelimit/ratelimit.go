@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit is a token bucket refilled at Rate tokens per second up to Burst tokens
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerHour returns a limit of count events per hour, all of which can happen at once
+func PerHour(count int) Limit {
+	return Limit{Rate: float64(count) / float64(time.Hour/time.Second), Burst: count}
+}
+
+// Enabled reports whether the limit restricts anything
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// Take refills a bucket that held tokens elapsed ago and takes n tokens from it. It returns the
+// tokens left and whether there were enough. If there were not, nothing is taken and wait is the
+// time until there are.
+func (l Limit) Take(tokens float64, elapsed time.Duration, n int) (left float64, wait time.Duration, ok bool) {
+	tokens = math.Min(float64(l.Burst), tokens+elapsed.Seconds()*l.Rate)
+	if tokens >= float64(n) {
+		return tokens - float64(n), 0, true
+	}
+	missing := float64(n) - tokens
+	return tokens, time.Duration(math.Ceil(missing / l.Rate * float64(time.Second))), false
+}
+
+// Limiter keeps a token bucket per key. Implementations either keep the buckets in memory, for a
+// single instance, or in a store shared by all instances.
+type Limiter interface {
+	// Allow takes n tokens from the bucket of the key. If there are not enough, it returns false
+	// and the time after which the request can be tried again.
+	Allow(ctx context.Context, key string, limit Limit, n int) (bool, time.Duration, error)
+	// Refund puts n tokens taken by Allow back into the bucket of the key, e.g. when the request
+	// they were taken for failed. The bucket never holds more than the burst.
+	Refund(ctx context.Context, key string, limit Limit, n int) error
+}
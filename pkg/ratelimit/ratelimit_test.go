@@ -0,0 +1,154 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Rate limiting", func() {
+	Describe("Limit", func() {
+		limit := Limit{Rate: 2, Burst: 4}
+
+		It("should take tokens while there are enough", func() {
+			left, wait, ok := limit.Take(4, 0, 3)
+			Expect(ok).To(BeTrue())
+			Expect(left).To(BeNumerically("~", 1))
+			Expect(wait).To(BeZero())
+		})
+
+		It("should refill up to the burst", func() {
+			left, _, ok := limit.Take(0, time.Hour, 1)
+			Expect(ok).To(BeTrue())
+			Expect(left).To(BeNumerically("~", 3))
+		})
+
+		It("should tell how long to wait when there are not enough tokens", func() {
+			left, wait, ok := limit.Take(0.5, 0, 1)
+			Expect(ok).To(BeFalse())
+			Expect(left).To(BeNumerically("~", 0.5))
+			Expect(wait).To(Equal(250 * time.Millisecond))
+		})
+
+		It("should spread hourly limits over the hour", func() {
+			limit := PerHour(5)
+			Expect(limit.Burst).To(Equal(5))
+			Expect(limit.Rate * 3600).To(BeNumerically("~", 5))
+		})
+	})
+
+	Describe("MemoryLimiter", func() {
+		var limiter *MemoryLimiter
+		var now time.Time
+		ctx := context.Background()
+
+		BeforeEach(func() {
+			now = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+			limiter = NewMemoryLimiter()
+			limiter.now = func() time.Time { return now }
+		})
+
+		It("should allow the burst and then reject", func() {
+			limit := Limit{Rate: 1, Burst: 2}
+			for i := 0; i < 2; i++ {
+				ok, _, err := limiter.Allow(ctx, "client:a", limit, 1)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ok).To(BeTrue())
+			}
+
+			ok, wait, err := limiter.Allow(ctx, "client:a", limit, 1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+			Expect(wait).To(Equal(time.Second))
+
+			now = now.Add(time.Second)
+			ok, _, _ = limiter.Allow(ctx, "client:a", limit, 1)
+			Expect(ok).To(BeTrue())
+		})
+
+		It("should keep a bucket per key", func() {
+			limit := Limit{Rate: 1, Burst: 1}
+			ok, _, _ := limiter.Allow(ctx, "client:a", limit, 1)
+			Expect(ok).To(BeTrue())
+			ok, _, _ = limiter.Allow(ctx, "client:b", limit, 1)
+			Expect(ok).To(BeTrue())
+			ok, _, _ = limiter.Allow(ctx, "client:a", limit, 1)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("should allow everything without a limit", func() {
+			for i := 0; i < 10; i++ {
+				ok, _, _ := limiter.Allow(ctx, "client:a", Limit{}, 1)
+				Expect(ok).To(BeTrue())
+			}
+		})
+
+		It("should put refunded tokens back up to the burst", func() {
+			limit := Limit{Rate: 1, Burst: 2}
+			limiter.Allow(ctx, "client:a", limit, 2)
+			Expect(limiter.Refund(ctx, "client:a", limit, 1)).To(Succeed())
+			ok, _, _ := limiter.Allow(ctx, "client:a", limit, 1)
+			Expect(ok).To(BeTrue())
+			ok, _, _ = limiter.Allow(ctx, "client:a", limit, 1)
+			Expect(ok).To(BeFalse())
+
+			Expect(limiter.Refund(ctx, "client:a", limit, 5)).To(Succeed())
+			Expect(limiter.buckets["client:a"].tokens).To(BeNumerically("~", 2))
+		})
+
+		It("should drop buckets that refilled", func() {
+			limit := Limit{Rate: 1, Burst: 1}
+			limiter.Allow(ctx, "client:a", limit, 1)
+			Expect(limiter.buckets).To(HaveLen(1))
+
+			now = now.Add(2 * sweepInterval)
+			limiter.Allow(ctx, "client:b", limit, 1)
+			Expect(limiter.buckets).To(HaveLen(1))
+			Expect(limiter.buckets).To(HaveKey("client:b"))
+		})
+	})
+})
+
+var _ = Describe("MemorySemaphore", func() {
+	var semaphore *MemorySemaphore
+	ctx := context.Background()
+
+	BeforeEach(func() {
+		semaphore = NewMemorySemaphore()
+	})
+
+	It("should hand out up to size slots per key", func() {
+		release, ok, err := semaphore.Acquire(ctx, "provider:a", 2, time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		_, ok, _ = semaphore.Acquire(ctx, "provider:a", 2, time.Minute)
+		Expect(ok).To(BeTrue())
+		_, ok, _ = semaphore.Acquire(ctx, "provider:a", 2, time.Minute)
+		Expect(ok).To(BeFalse())
+		_, ok, _ = semaphore.Acquire(ctx, "provider:b", 2, time.Minute)
+		Expect(ok).To(BeTrue())
+
+		release()
+		_, ok, _ = semaphore.Acquire(ctx, "provider:a", 2, time.Minute)
+		Expect(ok).To(BeTrue())
+	})
+
+	It("should free a slot only once", func() {
+		release, _, _ := semaphore.Acquire(ctx, "provider:a", 1, time.Minute)
+		release()
+		release()
+		_, ok, _ := semaphore.Acquire(ctx, "provider:a", 1, time.Minute)
+		Expect(ok).To(BeTrue())
+		_, ok, _ = semaphore.Acquire(ctx, "provider:a", 1, time.Minute)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should not limit without a size", func() {
+		for i := 0; i < 10; i++ {
+			_, ok, _ := semaphore.Acquire(ctx, "provider:a", 0, time.Minute)
+			Expect(ok).To(BeTrue())
+		}
+	})
+})
@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Semaphore bounds the number of holders of a key at the same time. Implementations either count
+// the holders in memory, for a single instance, or in a store shared by all instances.
+type Semaphore interface {
+	// Acquire takes one of size slots of the key. If all are taken, it returns false. The slot is
+	// freed by calling release, or after ttl in case the holder never does.
+	Acquire(ctx context.Context, key string, size int, ttl time.Duration) (release func(), ok bool, err error)
+}
+
+// MemorySemaphore counts the holders in memory, so every instance limits on its own. Holders of
+// a single process cannot disappear without releasing, so the ttl is not needed.
+type MemorySemaphore struct {
+	mu      sync.Mutex
+	holders map[string]int
+}
+
+func NewMemorySemaphore() *MemorySemaphore {
+	return &MemorySemaphore{holders: make(map[string]int)}
+}
+
+func (m *MemorySemaphore) Acquire(ctx context.Context, key string, size int, ttl time.Duration) (func(), bool, error) {
+	if size <= 0 {
+		return func() {}, true, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.holders[key] >= size {
+		return nil, false, nil
+	}
+	m.holders[key]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			if m.holders[key]--; m.holders[key] <= 0 {
+				delete(m.holders, key)
+			}
+		})
+	}, true, nil
+}
@@ -0,0 +1,80 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"notification-system/pkg/config"
+	"notification-system/pkg/queue"
+	"notification-system/pkg/storage"
+	"time"
+)
+
+const (
+	defaultPollInterval = time.Second
+	defaultBatchSize    = 100
+)
+
+// Relay publishes notifications from the outbox table to RabbitMQ. It covers the cases in which the
+// notification was stored, but publishing it right away failed or never happened. It also acts as
+// the scheduler for notifications with sendAt, publishing them once they come due.
+type Relay struct {
+	db     *storage.Database
+	queue  *queue.QueueClient
+	config config.RelayConfig
+}
+
+func NewRelay(db *storage.Database, q *queue.QueueClient, cfg config.RelayConfig) *Relay {
+	return &Relay{
+		db:     db,
+		queue:  q,
+		config: cfg,
+	}
+}
+
+// Start polls the outbox until the context is done
+func (r *Relay) Start(ctx context.Context) {
+	pollInterval := time.Duration(r.config.PollIntervalMs) * time.Millisecond
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.dispatch(ctx)
+		}
+	}
+}
+
+// dispatch publishes the due outbox entries. A batch in progress is finished when the context is
+// done, but no further batches are started.
+func (r *Relay) dispatch(stop context.Context) {
+	batchSize := r.config.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	gracePeriod := time.Duration(r.config.GracePeriodMs) * time.Millisecond
+
+	// Keep going while full batches are being dispatched, so a backlog is drained quickly
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		dispatched, err := r.db.DispatchOutbox(ctx, batchSize, gracePeriod, r.queue.Publish)
+		cancel()
+
+		if err != nil {
+			fmt.Printf("Failed to dispatch outbox: %v\n", err)
+			return
+		}
+		if dispatched > 0 {
+			fmt.Printf("Relay published %d notifications from the outbox\n", dispatched)
+		}
+		if dispatched < batchSize || stop.Err() != nil {
+			return
+		}
+	}
+}
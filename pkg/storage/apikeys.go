@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"notification-system/pkg/model"
+	"time"
+)
+
+const apiKeyColumns = `id::text AS id, client_id, name, key_prefix, created_at, expires_at, revoked_at`
+
+// activeAPIKey matches keys that are neither revoked nor expired after a rotation
+const activeAPIKey = `revoked_at IS NULL AND (expires_at IS NULL OR expires_at > now())`
+
+// CreateAPIKey stores a new API key by the hash of the key
+func (d *Database) CreateAPIKey(ctx context.Context, k model.APIKey, keyHash string) error {
+	_, err := d.db.ExecContext(ctx, `
+		INSERT INTO api_keys (id, client_id, name, key_hash, key_prefix, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		k.ID, k.ClientID, k.Name, keyHash, k.Prefix, k.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+	return nil
+}
+
+// GetAPIKeyByHash returns the active API key with the given hash
+func (d *Database) GetAPIKeyByHash(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	var k model.APIKey
+	err := d.db.GetContext(ctx, &k, `
+		SELECT `+apiKeyColumns+`
+		FROM api_keys
+		WHERE key_hash = $1 AND `+activeAPIKey, keyHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	return &k, nil
+}
+
+// ListAPIKeys returns the API keys of a client, or of all clients if clientID is empty, newest first
+func (d *Database) ListAPIKeys(ctx context.Context, clientID string) ([]model.APIKey, error) {
+	keys := []model.APIKey{}
+	err := d.db.SelectContext(ctx, &keys, `
+		SELECT `+apiKeyColumns+`
+		FROM api_keys
+		WHERE $1 = '' OR client_id = $1
+		ORDER BY created_at DESC`, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey stops an active API key from working right away. It returns ErrNotFound if there
+// is no active key with the given ID.
+func (d *Database) RevokeAPIKey(ctx context.Context, id string) (*model.APIKey, error) {
+	var k model.APIKey
+	err := d.db.GetContext(ctx, &k, `
+		UPDATE api_keys SET revoked_at = now()
+		WHERE id::text = $1 AND `+activeAPIKey+`
+		RETURNING `+apiKeyColumns, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	return &k, nil
+}
+
+// RotateAPIKey replaces an active API key with a new one of the same client and name. The old key
+// keeps working for the grace period, so clients can switch without downtime. The client and name
+// of next are taken from the old key. It returns ErrNotFound if there is no active key with the
+// given ID.
+func (d *Database) RotateAPIKey(ctx context.Context, id string, next *model.APIKey, keyHash string, grace time.Duration) error {
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var old model.APIKey
+	err = tx.GetContext(ctx, &old, `
+		UPDATE api_keys SET expires_at = LEAST(COALESCE(expires_at, 'infinity'), $1)
+		WHERE id::text = $2 AND `+activeAPIKey+`
+		RETURNING `+apiKeyColumns, time.Now().Add(grace), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to expire API key: %w", err)
+	}
+
+	next.ClientID = old.ClientID
+	next.Name = old.Name
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO api_keys (id, client_id, name, key_hash, key_prefix, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		next.ID, next.ClientID, next.Name, keyHash, next.Prefix, next.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit rotation: %w", err)
+	}
+	return nil
+}
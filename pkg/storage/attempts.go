@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"notification-system/pkg/model"
+)
+
+// RecordAttempt adds a delivery attempt to the history of a notification
+func (d *Database) RecordAttempt(ctx context.Context, a model.NotificationAttempt) error {
+	_, err := d.db.NamedExecContext(ctx, `
+		INSERT INTO notification_attempts (notification_id, attempt, provider, started_at, duration_ms, error, provider_message_id)
+		VALUES (:notification_id, :attempt, :provider, :started_at, :duration_ms, :error, :provider_message_id)`, a)
+	if err != nil {
+		return fmt.Errorf("failed to record attempt: %w", err)
+	}
+	return nil
+}
+
+// ListAttempts returns the delivery attempts of a notification, oldest first
+func (d *Database) ListAttempts(ctx context.Context, notificationID string) ([]model.NotificationAttempt, error) {
+	attempts := []model.NotificationAttempt{}
+	err := d.db.SelectContext(ctx, &attempts, `
+		SELECT id, notification_id::text AS notification_id, attempt, provider, started_at, duration_ms, error, provider_message_id
+		FROM notification_attempts
+		WHERE notification_id::text = $1
+		ORDER BY started_at, id`, notificationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list attempts: %w", err)
+	}
+	return attempts, nil
+}
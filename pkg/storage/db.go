@@ -2,23 +2,51 @@ package storage
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"notification-system/pkg/config"
 	"notification-system/pkg/model"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
+const (
+	notificationColumns = `id::text, channel, recipient, message, metadata, status, attempts, last_error, last_tried, created_at, idempotency_key, send_at, message_id::text, fallback, fallback_for::text, template_id::text, template_variables, user_id, priority, provider_message_id, callback_url, client_id`
+
+	// idempotencyKeyConflict matches the unique index that scopes idempotency keys per client
+	idempotencyKeyConflict = `((COALESCE(client_id, '')), idempotency_key)`
+
+	// insertBatchSize keeps multi-row inserts well below the Postgres limit of 65535 parameters
+	insertBatchSize = 1000
+)
+
+var (
+	// ErrNotFound is returned when the requested record does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicateIdempotencyKey is returned when a notification with the same idempotency key already exists
+	ErrDuplicateIdempotencyKey = errors.New("duplicate idempotency key")
+	// ErrNotCancellable is returned when cancelling a notification that is no longer pending or scheduled
+	ErrNotCancellable = errors.New("notification cannot be cancelled")
+	// ErrCancelled is returned when updating a notification that was cancelled in the meantime
+	ErrCancelled = errors.New("notification was cancelled")
+)
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
 type Database struct {
 	db *sqlx.DB
 }
 
 func NewDatabase(cfg config.DatabaseConfig) (*Database, error) {
-	db, err := sqlx.Connect("postgres", fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Name))
+	db, err := sqlx.Connect("postgres", dataSourceName(cfg))
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to DB: %w", err)
 	}
@@ -31,6 +59,11 @@ func NewDatabase(cfg config.DatabaseConfig) (*Database, error) {
 	return &Database{db: db}, nil
 }
 
+func dataSourceName(cfg config.DatabaseConfig) string {
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Name)
+}
+
 func (d *Database) Close() error {
 	if d.db != nil {
 		return d.db.Close()
@@ -38,48 +71,389 @@ func (d *Database) Close() error {
 	return nil
 }
 
+// SaveNotification stores a new notification together with its outbox entry in a single transaction,
+// so a notification is never persisted without being scheduled for publishing. Notifications with
+// SendAt set are held in the outbox until that time.
 func (d *Database) SaveNotification(ctx context.Context, n model.Notification) error {
-	metadata, _ := json.Marshal(n.Metadata)
-	_, err := d.db.NamedExecContext(ctx, `
-		INSERT INTO notifications (id, channel, recipient, message, metadata, status, attempts, created_at)
-		VALUES (:id, :channel, :recipient, :message, :metadata, :status, :attempts, :created_at)`,
-		map[string]interface{}{
-			"id":         n.ID,
-			"channel":    n.Channel,
-			"recipient":  n.Recipient,
-			"message":    n.Message,
-			"metadata":   metadata,
-			"status":     n.Status,
-			"attempts":   n.Attempts,
-			"created_at": n.CreatedAt,
-		})
-	return err
+	saved, err := d.SaveNotifications(ctx, []model.Notification{n})
+	if err != nil {
+		return err
+	}
+	if !saved[n.ID] {
+		return ErrDuplicateIdempotencyKey
+	}
+	return nil
+}
+
+// SaveNotifications stores notifications and their outbox entries using multi-row inserts in a single
+// transaction. Notifications whose idempotency key is already taken are skipped. It returns the set of
+// IDs of the stored notifications.
+func (d *Database) SaveNotifications(ctx context.Context, ns []model.Notification) (map[string]bool, error) {
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	saved, err := saveNotifications(ctx, tx, ns)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit notifications: %w", err)
+	}
+	return saved, nil
+}
+
+func saveNotifications(ctx context.Context, tx *sqlx.Tx, ns []model.Notification) (map[string]bool, error) {
+	saved := make(map[string]bool, len(ns))
+	for start := 0; start < len(ns); start += insertBatchSize {
+		end := min(start+insertBatchSize, len(ns))
+
+		ids, err := insertNotifications(ctx, tx, ns[start:end])
+		if err != nil {
+			return nil, err
+		}
+
+		// Only pending and scheduled notifications need to be published
+		var outbox []model.Notification
+		for _, n := range ns[start:end] {
+			if !ids[n.ID] {
+				continue
+			}
+			saved[n.ID] = true
+			if n.Status == model.StatusPending || n.Status == model.StatusScheduled {
+				outbox = append(outbox, n)
+			}
+		}
+		if err := insertOutbox(ctx, tx, outbox); err != nil {
+			return nil, err
+		}
+	}
+	return saved, nil
 }
 
+// insertNotifications inserts notifications with a single statement, skipping the ones with an
+// idempotency key that is already taken. It returns the set of IDs of the inserted notifications.
+func insertNotifications(ctx context.Context, tx *sqlx.Tx, ns []model.Notification) (map[string]bool, error) {
+	if len(ns) == 0 {
+		return nil, nil
+	}
+
+	var values []string
+	var args []interface{}
+	for _, n := range ns {
+		metadata, _ := json.Marshal(n.Metadata)
+		var fallback, variables []byte
+		if len(n.Fallback) > 0 {
+			fallback, _ = json.Marshal(n.Fallback)
+		}
+		if len(n.Variables) > 0 {
+			variables, _ = json.Marshal(n.Variables)
+		}
+		row := []interface{}{n.ID, n.Channel, n.Recipient, n.Message, metadata, n.Status, n.Attempts, n.CreatedAt, n.IdempotencyKey, n.SendAt, n.MessageID, fallback, n.FallbackFor, n.TemplateID, variables, n.UserID, n.Priority, n.CallbackURL, n.ClientID}
+		values = append(values, placeholders(len(args)+1, len(row)))
+		args = append(args, row...)
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		INSERT INTO notifications (id, channel, recipient, message, metadata, status, attempts, created_at, idempotency_key, send_at, message_id, fallback, fallback_for, template_id, template_variables, user_id, priority, callback_url, client_id)
+		VALUES `+strings.Join(values, ", ")+`
+		ON CONFLICT `+idempotencyKeyConflict+` DO NOTHING
+		RETURNING id::text`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert notifications: %w", err)
+	}
+	defer rows.Close()
+
+	inserted := make(map[string]bool, len(ns))
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to read inserted notification: %w", err)
+		}
+		inserted[id] = true
+	}
+	return inserted, rows.Err()
+}
+
+// placeholders returns a row of count positional parameters starting at $first, e.g. ($1, $2, $3)
+func placeholders(first, count int) string {
+	params := make([]string, count)
+	for i := range params {
+		params[i] = fmt.Sprintf("$%d", first+i)
+	}
+	return "(" + strings.Join(params, ", ") + ")"
+}
+
+// UpdateNotificationStatus stores the outcome of a send. Notifications cancelled while they were
+// sent are left alone, and ErrCancelled is returned for them.
 func (d *Database) UpdateNotificationStatus(ctx context.Context, n model.Notification) error {
 	metadata, _ := json.Marshal(n.Metadata)
-	_, err := d.db.NamedExecContext(ctx, `
-		UPDATE notifications SET status = :status, attempts = :attempts, last_error = :last_error, last_tried = :last_tried, metadata = :metadata
-		WHERE id = :id`,
+	result, err := d.db.NamedExecContext(ctx, `
+		UPDATE notifications SET status = :status, attempts = :attempts, last_error = :last_error, last_tried = :last_tried, metadata = :metadata,
+			provider_message_id = COALESCE(:provider_message_id, provider_message_id)
+		WHERE id = :id AND status <> :cancelled`,
 		map[string]interface{}{
-			"id":         n.ID,
-			"status":     n.Status,
-			"attempts":   n.Attempts,
-			"last_error": n.LastError,
-			"last_tried": n.LastTried,
-			"metadata":   metadata,
+			"id":                  n.ID,
+			"status":              n.Status,
+			"attempts":            n.Attempts,
+			"last_error":          n.LastError,
+			"last_tried":          n.LastTried,
+			"metadata":            metadata,
+			"provider_message_id": n.ProviderMessageID,
+			"cancelled":           model.StatusCancelled,
 		})
-	return err
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrCancelled
+	}
+	return nil
+}
+
+// CancelNotification moves a pending or scheduled notification to cancelled and removes it from the
+// outbox. Notifications that were already published are skipped by the worker.
+func (d *Database) CancelNotification(ctx context.Context, id string) (*model.Notification, error) {
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	n, err := getNotificationByID(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE notifications SET status = $1
+		WHERE id = $2 AND status IN ($3, $4)`,
+		model.StatusCancelled, n.ID, model.StatusPending, model.StatusScheduled)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel notification: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return n, ErrNotCancellable
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM outbox
+		WHERE notification_id = $1 AND dispatched_at IS NULL`, n.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove notification from outbox: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit cancellation: %w", err)
+	}
+
+	n.Status = model.StatusCancelled
+	return n, nil
+}
+
+// DeferNotification holds back a queued notification until the given time. It is scheduled again
+// and the relay publishes it from the outbox once it is due.
+func (d *Database) DeferNotification(ctx context.Context, n model.Notification, until time.Time) error {
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE notifications SET status = $1, send_at = $2
+		WHERE id = $3`,
+		model.StatusScheduled, until, n.ID)
+	if err != nil {
+		return fmt.Errorf("failed to defer notification: %w", err)
+	}
+
+	n.SendAt = &until
+	if err := insertOutbox(ctx, tx, []model.Notification{n}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit deferral: %w", err)
+	}
+	return nil
+}
+
+// ReplayNotification moves a notification from the DLQ back to pending, optionally with a new
+// recipient, and adds it to the outbox, so the relay publishes it if the caller does not.
+func (d *Database) ReplayNotification(ctx context.Context, n model.Notification) error {
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE notifications SET status = $1, recipient = $2
+		WHERE id = $3`,
+		model.StatusPending, n.Recipient, n.ID)
+	if err != nil {
+		return fmt.Errorf("failed to replay notification: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrNotFound
+	}
+
+	n.SendAt = nil
+	if err := insertOutbox(ctx, tx, []model.Notification{n}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit replay: %w", err)
+	}
+	return nil
+}
+
+// SetNotificationStatus changes the status of a notification without touching its attempts
+func (d *Database) SetNotificationStatus(ctx context.Context, id string, status model.NotificationStatus) error {
+	_, err := d.db.ExecContext(ctx, `UPDATE notifications SET status = $1 WHERE id = $2`, status, id)
+	if err != nil {
+		return fmt.Errorf("failed to update notification status: %w", err)
+	}
+	return nil
+}
+
+// GetNotificationsByIDs returns the stored notifications with the given IDs, unknown IDs are skipped
+func (d *Database) GetNotificationsByIDs(ctx context.Context, ids []string) (map[string]model.Notification, error) {
+	notifications := make(map[string]model.Notification, len(ids))
+	if len(ids) == 0 {
+		return notifications, nil
+	}
+
+	rows, err := d.db.QueryxContext(ctx, `
+		SELECT `+notificationColumns+`
+		FROM notifications
+		WHERE id::text = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notifications: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, err
+		}
+		notifications[n.ID] = *n
+	}
+	return notifications, rows.Err()
+}
+
+// UpdateDeliveryStatus applies a delivery receipt to the notification sent as the given provider
+// message and returns the updated notification. Only sent notifications, or delivered ones that
+// bounce later, are updated, so receipts applied before are skipped and nil is returned for them.
+// It returns ErrNotFound if no notification with the provider message ID is stored yet.
+func (d *Database) UpdateDeliveryStatus(ctx context.Context, channel model.NotificationChannel, providerMessageID string, status model.NotificationStatus, reason *string) (*model.Notification, error) {
+	row := d.db.QueryRowxContext(ctx, `
+		UPDATE notifications SET status = $1, last_error = COALESCE($2, last_error)
+		WHERE channel = $3 AND provider_message_id = $4 AND status IN ($5, $6) AND status <> $1
+		RETURNING `+notificationColumns,
+		status, reason, channel, providerMessageID, model.StatusSent, model.StatusDelivered)
+
+	n, err := scanNotification(row)
+	if err == nil {
+		return n, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("failed to update delivery status: %w", err)
+	}
+
+	var exists bool
+	err = d.db.GetContext(ctx, &exists, `
+		SELECT EXISTS (SELECT 1 FROM notifications WHERE channel = $1 AND provider_message_id = $2)`,
+		channel, providerMessageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up provider message: %w", err)
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return nil, nil
 }
 
 func (d *Database) GetNotificationByID(ctx context.Context, id string) (*model.Notification, error) {
-	var n model.Notification
-	var metadataJSON []byte
+	return getNotificationByID(ctx, d.db, id)
+}
 
-	err := d.db.QueryRowxContext(ctx, `
-		SELECT id::text, channel, recipient, message, metadata, status, attempts, last_error, last_tried, created_at
+func getNotificationByID(ctx context.Context, q sqlx.QueryerContext, id string) (*model.Notification, error) {
+	row := q.QueryRowxContext(ctx, `
+		SELECT `+notificationColumns+`
 		FROM notifications 
-		WHERE id::text = $1`, id).Scan(
+		WHERE id::text = $1`, id)
+
+	n, err := scanNotification(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification: %w", err)
+	}
+	return n, nil
+}
+
+// GetNotificationByIdempotencyKey returns the notification the client created with the given
+// idempotency key, a nil client being the admin. Keys older than the window are released first, so
+// they can be reused by new notifications. A zero window keeps keys forever.
+func (d *Database) GetNotificationByIdempotencyKey(ctx context.Context, clientID *string, key string, window time.Duration) (*model.Notification, error) {
+	notifications, err := d.GetNotificationsByIdempotencyKeys(ctx, clientID, []string{key}, window)
+	if err != nil {
+		return nil, err
+	}
+	n, ok := notifications[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &n, nil
+}
+
+// GetNotificationsByIdempotencyKeys is GetNotificationByIdempotencyKey for many keys at once. It
+// returns the notifications by idempotency key, unknown keys are skipped.
+func (d *Database) GetNotificationsByIdempotencyKeys(ctx context.Context, clientID *string, keys []string, window time.Duration) (map[string]model.Notification, error) {
+	notifications := make(map[string]model.Notification, len(keys))
+	if len(keys) == 0 {
+		return notifications, nil
+	}
+
+	if window > 0 {
+		_, err := d.db.ExecContext(ctx, `
+			UPDATE notifications SET idempotency_key = NULL
+			WHERE COALESCE(client_id, '') = COALESCE($1, '') AND idempotency_key = ANY($2) AND created_at < $3`,
+			clientID, pq.Array(keys), time.Now().Add(-window))
+		if err != nil {
+			return nil, fmt.Errorf("failed to release idempotency keys: %w", err)
+		}
+	}
+
+	rows, err := d.db.QueryxContext(ctx, `
+		SELECT `+notificationColumns+`
+		FROM notifications
+		WHERE COALESCE(client_id, '') = COALESCE($1, '') AND idempotency_key = ANY($2)`, clientID, pq.Array(keys))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notifications by idempotency key: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get notifications by idempotency key: %w", err)
+		}
+		notifications[*n.IdempotencyKey] = *n
+	}
+	return notifications, rows.Err()
+}
+
+func scanNotification(row rowScanner) (*model.Notification, error) {
+	var n model.Notification
+	var metadataJSON, fallbackJSON, variablesJSON []byte
+
+	err := row.Scan(
 		&n.ID,
 		&n.Channel,
 		&n.Recipient,
@@ -90,9 +464,24 @@ func (d *Database) GetNotificationByID(ctx context.Context, id string) (*model.N
 		&n.LastError,
 		&n.LastTried,
 		&n.CreatedAt,
+		&n.IdempotencyKey,
+		&n.SendAt,
+		&n.MessageID,
+		&fallbackJSON,
+		&n.FallbackFor,
+		&n.TemplateID,
+		&variablesJSON,
+		&n.UserID,
+		&n.Priority,
+		&n.ProviderMessageID,
+		&n.CallbackURL,
+		&n.ClientID,
 	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get notification: %w", err)
+		return nil, err
 	}
 
 	// Unmarshal metadata if it exists
@@ -101,6 +490,25 @@ func (d *Database) GetNotificationByID(ctx context.Context, id string) (*model.N
 			return nil, fmt.Errorf("failed to unmarshal metadata: %w", err)
 		}
 	}
+	if len(fallbackJSON) > 0 {
+		if err := json.Unmarshal(fallbackJSON, &n.Fallback); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal fallback: %w", err)
+		}
+	}
+	if len(variablesJSON) > 0 {
+		if err := json.Unmarshal(variablesJSON, &n.Variables); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal template variables: %w", err)
+		}
+	}
 
 	return &n, nil
-}
\ No newline at end of file
+}
+
+// isUniqueViolation reports whether err is a Postgres unique violation of the given constraint
+func isUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == "23505" && pqErr.Constraint == constraint
+}
@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"notification-system/pkg/config"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// StatusChannel is the Postgres notification channel the notifications trigger publishes status changes to
+const StatusChannel = "notification_status"
+
+// NewStatusListener opens a dedicated connection listening for status changes of notifications.
+// The listener reconnects on its own and sends a nil notification after reconnecting, since
+// changes published in the meantime are lost.
+func NewStatusListener(cfg config.DatabaseConfig) (*pq.Listener, error) {
+	listener := pq.NewListener(dataSourceName(cfg), time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Status listener: %v", err)
+		}
+	})
+	if err := listener.Listen(StatusChannel); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to listen for status changes: %w", err)
+	}
+	return listener, nil
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"notification-system/pkg/model"
+)
+
+// SaveMessage stores a message together with its child notifications and their outbox entries
+func (d *Database) SaveMessage(ctx context.Context, m model.Message, ns []model.Notification) error {
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	metadata, _ := json.Marshal(m.Metadata)
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO messages (id, message, metadata, client_id, created_at)
+		VALUES ($1, $2, $3, $4, $5)`, m.ID, m.Message, metadata, m.ClientID, m.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert message: %w", err)
+	}
+
+	if _, err := saveNotifications(ctx, tx, ns); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetMessageByID returns a message with all of its child notifications
+func (d *Database) GetMessageByID(ctx context.Context, id string) (*model.Message, error) {
+	var m model.Message
+	var metadataJSON []byte
+
+	err := d.db.QueryRowxContext(ctx, `
+		SELECT id::text, message, metadata, client_id, created_at
+		FROM messages
+		WHERE id::text = $1`, id).Scan(&m.ID, &m.Message, &metadataJSON, &m.ClientID, &m.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+
+	if len(metadataJSON) > 0 {
+		if err := json.Unmarshal(metadataJSON, &m.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal metadata: %w", err)
+		}
+	}
+
+	rows, err := d.db.QueryxContext(ctx, `
+		SELECT `+notificationColumns+`
+		FROM notifications
+		WHERE message_id = $1
+		ORDER BY created_at`, m.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message notifications: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		m.Notifications = append(m.Notifications, *n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read message notifications: %w", err)
+	}
+
+	return &m, nil
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"notification-system/pkg/model"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// insertOutbox schedules notifications for publishing at their SendAt, or right away when it is not set
+func insertOutbox(ctx context.Context, tx *sqlx.Tx, ns []model.Notification) error {
+	if len(ns) == 0 {
+		return nil
+	}
+
+	var values []string
+	var args []interface{}
+	for _, n := range ns {
+		values = append(values, fmt.Sprintf("($%d::uuid, COALESCE($%d::timestamptz, now()))", len(args)+1, len(args)+2))
+		args = append(args, n.ID, n.SendAt)
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO outbox (notification_id, available_at)
+		VALUES `+strings.Join(values, ", "), args...)
+	if err != nil {
+		return fmt.Errorf("failed to insert outbox entries: %w", err)
+	}
+	return nil
+}
+
+// MarkOutboxDispatched marks the outbox entries of the given notifications as published
+func (d *Database) MarkOutboxDispatched(ctx context.Context, notificationIDs ...string) error {
+	_, err := d.db.ExecContext(ctx, `
+		UPDATE outbox SET dispatched_at = now()
+		WHERE notification_id::text = ANY($1) AND dispatched_at IS NULL`, pq.Array(notificationIDs))
+	return err
+}
+
+// DispatchOutbox locks up to limit due, undispatched outbox entries older than minAge, calls publish
+// for the notification of each of them and marks the successfully published ones as dispatched.
+// Scheduled notifications are moved to pending before they are published. Locked rows are skipped,
+// so several relays can run against the same database. minAge gives the API a chance to publish
+// fresh notifications itself before the relay picks them up.
+// It returns the number of dispatched entries.
+func (d *Database) DispatchOutbox(ctx context.Context, limit int, minAge time.Duration, publish func(model.Notification) error) (int, error) {
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	type entry struct {
+		ID             int64  `db:"id"`
+		NotificationID string `db:"notification_id"`
+	}
+	var entries []entry
+	err = tx.SelectContext(ctx, &entries, `
+		SELECT id, notification_id::text AS notification_id
+		FROM outbox
+		WHERE dispatched_at IS NULL
+			AND available_at <= now()
+			AND created_at <= now() - make_interval(secs => $2)
+		ORDER BY available_at, id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED`, limit, minAge.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to query outbox: %w", err)
+	}
+
+	dispatched := 0
+	var publishErr error
+	for _, e := range entries {
+		n, err := getNotificationByID(ctx, tx, e.NotificationID)
+		if err != nil {
+			return 0, err
+		}
+		scheduled := n.Status == model.StatusScheduled
+		if scheduled {
+			n.Status = model.StatusPending
+		}
+		if publishErr = publish(*n); publishErr != nil {
+			// Leave the rest for the next run, but keep the ones already published
+			break
+		}
+		if scheduled {
+			_, err := tx.ExecContext(ctx, `
+				UPDATE notifications SET status = $1
+				WHERE id = $2 AND status = $3`, model.StatusPending, n.ID, model.StatusScheduled)
+			if err != nil {
+				return 0, fmt.Errorf("failed to update scheduled notification: %w", err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE outbox SET dispatched_at = now() WHERE id = $1`, e.ID); err != nil {
+			return 0, fmt.Errorf("failed to mark outbox entry as dispatched: %w", err)
+		}
+		dispatched++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit outbox dispatch: %w", err)
+	}
+	if publishErr != nil {
+		return dispatched, fmt.Errorf("failed to publish notification: %w", publishErr)
+	}
+	return dispatched, nil
+}
@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"notification-system/pkg/model"
+	"notification-system/pkg/ratelimit"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// limiterSweepInterval is how often buckets that refilled completely are deleted
+	limiterSweepInterval = time.Minute
+	// rejectionRetention is how long rate limit rejections are kept
+	rejectionRetention = 30 * 24 * time.Hour
+)
+
+// PostgresLimiter keeps the token buckets in Postgres, so the limits are shared by all instances
+type PostgresLimiter struct {
+	db        *Database
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+func NewPostgresLimiter(db *Database) *PostgresLimiter {
+	return &PostgresLimiter{db: db}
+}
+
+// Allow takes tokens from the bucket of the key in a transaction that locks its row. The clock of
+// the database is used, so instances with skewed clocks refill buckets the same way.
+func (p *PostgresLimiter) Allow(ctx context.Context, key string, limit ratelimit.Limit, n int) (bool, time.Duration, error) {
+	if !limit.Enabled() {
+		return true, 0, nil
+	}
+	p.sweep(ctx)
+
+	tx, err := p.db.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Updating an existing bucket locks it right away, so a sweep cannot delete it in between
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO rate_limits (key, tokens, rate, burst, updated_at)
+		VALUES ($1, $2, $3, $4, now())
+		ON CONFLICT (key) DO UPDATE SET rate = EXCLUDED.rate, burst = EXCLUDED.burst`,
+		key, float64(limit.Burst), limit.Rate, limit.Burst)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to create rate limit bucket: %w", err)
+	}
+
+	var tokens float64
+	var updated, now time.Time
+	err = tx.QueryRowxContext(ctx, `
+		SELECT tokens, updated_at, now()
+		FROM rate_limits
+		WHERE key = $1
+		FOR UPDATE`, key).Scan(&tokens, &updated, &now)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to get rate limit bucket: %w", err)
+	}
+
+	left, wait, allowed := limit.Take(tokens, now.Sub(updated), n)
+	_, err = tx.ExecContext(ctx, `
+		UPDATE rate_limits SET tokens = $1, updated_at = $2
+		WHERE key = $3`, left, now, key)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to update rate limit bucket: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, 0, fmt.Errorf("failed to commit rate limit: %w", err)
+	}
+	return allowed, wait, nil
+}
+
+// Refund puts tokens back into the bucket of the key. A bucket that was deleted is full already.
+func (p *PostgresLimiter) Refund(ctx context.Context, key string, limit ratelimit.Limit, n int) error {
+	if !limit.Enabled() {
+		return nil
+	}
+
+	_, err := p.db.db.ExecContext(ctx, `
+		UPDATE rate_limits SET tokens = LEAST($2::double precision, tokens + $3)
+		WHERE key = $1`, key, limit.Burst, n)
+	if err != nil {
+		return fmt.Errorf("failed to refund rate limit tokens: %w", err)
+	}
+	return nil
+}
+
+// sweep deletes the buckets that are full again, they are recreated full when needed. Failures are
+// only logged, the buckets are deleted by the next sweep.
+func (p *PostgresLimiter) sweep(ctx context.Context) {
+	p.mu.Lock()
+	if time.Since(p.lastSweep) < limiterSweepInterval {
+		p.mu.Unlock()
+		return
+	}
+	p.lastSweep = time.Now()
+	p.mu.Unlock()
+
+	_, err := p.db.db.ExecContext(ctx, `
+		DELETE FROM rate_limits
+		WHERE tokens + EXTRACT(EPOCH FROM now() - updated_at) * rate >= burst`)
+	if err != nil {
+		log.Printf("Failed to delete full rate limit buckets: %v", err)
+	}
+}
+
+// PostgresSemaphore keeps the in-flight slots in Postgres, so the limits are shared by all
+// instances. Slots are leased, so the ones of a crashed instance are freed when the lease expires.
+type PostgresSemaphore struct {
+	db *Database
+}
+
+func NewPostgresSemaphore(db *Database) *PostgresSemaphore {
+	return &PostgresSemaphore{db: db}
+}
+
+// Acquire leases the first free slot of the key. Slots are created on first use, and the ones
+// beyond the size are left alone when the size is lowered.
+func (p *PostgresSemaphore) Acquire(ctx context.Context, key string, size int, ttl time.Duration) (func(), bool, error) {
+	if size <= 0 {
+		return func() {}, true, nil
+	}
+
+	_, err := p.db.db.ExecContext(ctx, `
+		INSERT INTO rate_limit_leases (key, slot)
+		SELECT $1, generate_series(0, $2 - 1)
+		ON CONFLICT (key, slot) DO NOTHING`, key, size)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create in-flight slots: %w", err)
+	}
+
+	holder := uuid.New().String()
+	var slot int
+	err = p.db.db.QueryRowxContext(ctx, `
+		UPDATE rate_limit_leases
+		SET holder = $3, expires_at = now() + make_interval(secs => $4)
+		WHERE (key, slot) = (
+			SELECT key, slot
+			FROM rate_limit_leases
+			WHERE key = $1 AND slot < $2 AND expires_at <= now()
+			ORDER BY slot
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING slot`, key, size, holder, ttl.Seconds()).Scan(&slot)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to lease in-flight slot: %w", err)
+	}
+
+	return func() {
+		// The context of the send may be done already, the slot is freed anyway
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err := p.db.db.ExecContext(ctx, `
+			UPDATE rate_limit_leases SET holder = NULL, expires_at = now()
+			WHERE key = $1 AND slot = $2 AND holder = $3`, key, slot, holder)
+		if err != nil {
+			log.Printf("Failed to free in-flight slot %d of %s, it is freed when its lease expires: %v", slot, key, err)
+		}
+	}, true, nil
+}
+
+// RecordRateLimitRejection stores a request or notification rejected by a rate limit. Rejections
+// older than the retention are deleted along the way.
+func (d *Database) RecordRateLimitRejection(ctx context.Context, r model.RateLimitRejection) error {
+	_, err := d.db.NamedExecContext(ctx, `
+		INSERT INTO rate_limit_rejections (client_id, limit_type, key, channel, retry_after_ms, created_at)
+		VALUES (:client_id, :limit_type, :key, :channel, :retry_after_ms, :created_at)`, r)
+	if err != nil {
+		return fmt.Errorf("failed to record rate limit rejection: %w", err)
+	}
+
+	_, err = d.db.ExecContext(ctx, `
+		DELETE FROM rate_limit_rejections WHERE created_at < $1`, time.Now().Add(-rejectionRetention))
+	if err != nil {
+		return fmt.Errorf("failed to delete old rate limit rejections: %w", err)
+	}
+	return nil
+}
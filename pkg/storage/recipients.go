@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"notification-system/pkg/model"
+
+	"github.com/lib/pq"
+)
+
+const (
+	recipientColumns = `id, email, phone, slack_channel, preferences, time_zone, quiet_hours, created_at, updated_at`
+
+	recipientPrimaryKey = "recipients_pkey"
+)
+
+// ErrDuplicateRecipient is returned when a recipient with the same ID already exists
+var ErrDuplicateRecipient = errors.New("recipient already exists")
+
+func (d *Database) CreateRecipient(ctx context.Context, r model.Recipient) error {
+	quietHours, _ := json.Marshal(r.QuietHours)
+	_, err := d.db.ExecContext(ctx, `
+		INSERT INTO recipients (id, email, phone, slack_channel, preferences, time_zone, quiet_hours, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		r.ID, r.Email, r.Phone, r.SlackChannel, pq.Array(channelsToStrings(r.Preferences)), r.TimeZone, quietHours, r.CreatedAt, r.UpdatedAt)
+	if isUniqueViolation(err, recipientPrimaryKey) {
+		return ErrDuplicateRecipient
+	}
+	return err
+}
+
+func (d *Database) UpdateRecipient(ctx context.Context, r model.Recipient) error {
+	quietHours, _ := json.Marshal(r.QuietHours)
+	result, err := d.db.ExecContext(ctx, `
+		UPDATE recipients SET email = $2, phone = $3, slack_channel = $4, preferences = $5, time_zone = $6, quiet_hours = $7, updated_at = $8
+		WHERE id = $1`,
+		r.ID, r.Email, r.Phone, r.SlackChannel, pq.Array(channelsToStrings(r.Preferences)), r.TimeZone, quietHours, r.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update recipient: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (d *Database) GetRecipientByID(ctx context.Context, id string) (*model.Recipient, error) {
+	row := d.db.QueryRowxContext(ctx, `
+		SELECT `+recipientColumns+`
+		FROM recipients
+		WHERE id = $1`, id)
+
+	r, err := scanRecipient(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recipient: %w", err)
+	}
+	return r, nil
+}
+
+func (d *Database) DeleteRecipient(ctx context.Context, id string) error {
+	result, err := d.db.ExecContext(ctx, `DELETE FROM recipients WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete recipient: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func scanRecipient(row rowScanner) (*model.Recipient, error) {
+	var r model.Recipient
+	var preferences []string
+	var quietHoursJSON []byte
+
+	err := row.Scan(
+		&r.ID,
+		&r.Email,
+		&r.Phone,
+		&r.SlackChannel,
+		pq.Array(&preferences),
+		&r.TimeZone,
+		&quietHoursJSON,
+		&r.CreatedAt,
+		&r.UpdatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, channel := range preferences {
+		r.Preferences = append(r.Preferences, model.NotificationChannel(channel))
+	}
+
+	if len(quietHoursJSON) > 0 {
+		if err := json.Unmarshal(quietHoursJSON, &r.QuietHours); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal quiet hours: %w", err)
+		}
+	}
+	return &r, nil
+}
+
+func channelsToStrings(channels []model.NotificationChannel) []string {
+	result := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		result = append(result, string(channel))
+	}
+	return result
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"notification-system/pkg/model"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+const (
+	suppressionColumns = `id::text AS id, channel, recipient, category, reason, created_at`
+
+	suppressionConstraint = "suppressions_channel_recipient_category_key"
+)
+
+// ErrDuplicateSuppression is returned when the recipient is already suppressed for the channel and category
+var ErrDuplicateSuppression = errors.New("suppression already exists")
+
+func (d *Database) CreateSuppression(ctx context.Context, s model.Suppression) error {
+	_, err := d.db.NamedExecContext(ctx, `
+		INSERT INTO suppressions (id, channel, recipient, category, reason, created_at)
+		VALUES (:id, :channel, :recipient, :category, :reason, :created_at)`, s)
+	if isUniqueViolation(err, suppressionConstraint) {
+		return ErrDuplicateSuppression
+	}
+	return err
+}
+
+// ListSuppressions returns the suppressions, optionally filtered by channel and recipient
+func (d *Database) ListSuppressions(ctx context.Context, channel, recipient string) ([]model.Suppression, error) {
+	var conditions []string
+	var args []interface{}
+	if channel != "" {
+		args = append(args, channel)
+		conditions = append(conditions, fmt.Sprintf("channel = $%d", len(args)))
+	}
+	if recipient != "" {
+		args = append(args, recipient)
+		conditions = append(conditions, fmt.Sprintf("lower(recipient) = lower($%d)", len(args)))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	suppressions := []model.Suppression{}
+	err := d.db.SelectContext(ctx, &suppressions, `
+		SELECT `+suppressionColumns+`
+		FROM suppressions
+		`+where+`
+		ORDER BY created_at DESC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list suppressions: %w", err)
+	}
+	return suppressions, nil
+}
+
+func (d *Database) DeleteSuppression(ctx context.Context, id string) error {
+	result, err := d.db.ExecContext(ctx, `DELETE FROM suppressions WHERE id::text = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete suppression: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SuppressedNotifications returns the set of IDs of the notifications whose recipient is suppressed
+// for their channel and category. The category is taken from the category metadata.
+func (d *Database) SuppressedNotifications(ctx context.Context, ns []model.Notification) (map[string]bool, error) {
+	suppressed := make(map[string]bool)
+	if len(ns) == 0 {
+		return suppressed, nil
+	}
+
+	ids := make([]string, len(ns))
+	channels := make([]string, len(ns))
+	recipients := make([]string, len(ns))
+	categories := make([]string, len(ns))
+	for i, n := range ns {
+		ids[i] = n.ID
+		channels[i] = string(n.Channel)
+		recipients[i] = n.Recipient
+		categories[i] = n.Metadata[model.MetadataCategory]
+	}
+
+	rows, err := d.db.QueryContext(ctx, `
+		SELECT t.id
+		FROM unnest($1::text[], $2::text[], $3::text[], $4::text[]) AS t(id, channel, recipient, category)
+		WHERE EXISTS (
+			SELECT 1 FROM suppressions s
+			WHERE s.channel = t.channel
+				AND lower(s.recipient) = lower(t.recipient)
+				AND (s.category IS NULL OR s.category = t.category)
+		)`, pq.Array(ids), pq.Array(channels), pq.Array(recipients), pq.Array(categories))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check suppressions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to read suppressed notification: %w", err)
+		}
+		suppressed[id] = true
+	}
+	return suppressed, rows.Err()
+}
+
+// IsSuppressed reports whether the recipient of a notification is suppressed for its channel and category
+func (d *Database) IsSuppressed(ctx context.Context, n model.Notification) (bool, error) {
+	suppressed, err := d.SuppressedNotifications(ctx, []model.Notification{n})
+	if err != nil {
+		return false, err
+	}
+	return suppressed[n.ID], nil
+}
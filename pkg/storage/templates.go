@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"notification-system/pkg/model"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+const (
+	templateColumns = `id::text AS id, name, locale, version, published_at, sms_body, email_subject, email_text, email_html, slack_text, COALESCE(slack_blocks, '') AS slack_blocks, created_at, updated_at`
+
+	templateVersionConstraint = "templates_name_locale_version_key"
+)
+
+var (
+	// ErrDuplicateTemplate is returned when a template with the same name, locale and version already exists
+	ErrDuplicateTemplate = errors.New("template already exists")
+	// ErrTemplatePublished is returned when changing a published template version
+	ErrTemplatePublished = errors.New("template version is published")
+)
+
+// CreateTemplate stores a new draft version of a template. The version is the next one for the name
+// and locale of the template. It returns the stored template.
+func (d *Database) CreateTemplate(ctx context.Context, t model.Template) (*model.Template, error) {
+	var created model.Template
+	err := d.db.GetContext(ctx, &created, `
+		INSERT INTO templates (id, name, locale, version, sms_body, email_subject, email_text, email_html, slack_text, slack_blocks, created_at, updated_at)
+		SELECT $1, $2, $3, COALESCE(MAX(version), 0) + 1, $4, $5, $6, $7, $8, $9, $10, $10
+		FROM templates
+		WHERE name = $2 AND lower(locale) = lower($3)
+		RETURNING `+templateColumns,
+		t.ID, t.Name, t.Locale, t.SMSBody, t.EmailSubject, t.EmailText, t.EmailHTML, t.SlackText, t.SlackBlocks, t.CreatedAt)
+	if isUniqueViolation(err, templateVersionConstraint) {
+		return nil, ErrDuplicateTemplate
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create template: %w", err)
+	}
+	return &created, nil
+}
+
+// UpdateTemplate replaces the bodies of a draft template version. Published versions cannot be
+// changed, a new version has to be created instead.
+func (d *Database) UpdateTemplate(ctx context.Context, t model.Template) error {
+	result, err := d.db.NamedExecContext(ctx, `
+		UPDATE templates SET sms_body = :sms_body, email_subject = :email_subject, email_text = :email_text,
+			email_html = :email_html, slack_text = :slack_text, slack_blocks = :slack_blocks, updated_at = :updated_at
+		WHERE id::text = :id AND published_at IS NULL`, t)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		if _, err := d.GetTemplateByID(ctx, t.ID); err != nil {
+			return err
+		}
+		return ErrTemplatePublished
+	}
+	return nil
+}
+
+// PublishTemplate makes a template version available for resolving by name
+func (d *Database) PublishTemplate(ctx context.Context, id string) (*model.Template, error) {
+	var t model.Template
+	err := d.db.GetContext(ctx, &t, `
+		UPDATE templates SET published_at = COALESCE(published_at, now())
+		WHERE id::text = $1
+		RETURNING `+templateColumns, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to publish template: %w", err)
+	}
+	return &t, nil
+}
+
+func (d *Database) GetTemplateByID(ctx context.Context, id string) (*model.Template, error) {
+	var t model.Template
+	err := d.db.GetContext(ctx, &t, `
+		SELECT `+templateColumns+`
+		FROM templates
+		WHERE id::text = $1`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get template: %w", err)
+	}
+	return &t, nil
+}
+
+// ResolveTemplate returns the published version of the named template for the first of the given
+// locales that has one. When version is nil, the latest published version is returned. Locales are
+// compared case-insensitively.
+func (d *Database) ResolveTemplate(ctx context.Context, name string, locales []string, version *int) (*model.Template, error) {
+	lowered := make([]string, len(locales))
+	for i, locale := range locales {
+		lowered[i] = strings.ToLower(locale)
+	}
+
+	var t model.Template
+	err := d.db.GetContext(ctx, &t, `
+		SELECT `+templateColumns+`
+		FROM templates
+		WHERE name = $1
+			AND lower(locale) = ANY($2)
+			AND published_at IS NOT NULL
+			AND ($3::int IS NULL OR version = $3)
+		ORDER BY array_position($2, lower(locale)), version DESC
+		LIMIT 1`, name, pq.Array(lowered), version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve template: %w", err)
+	}
+	return &t, nil
+}
+
+// ListTemplates returns all template versions, optionally filtered by name and locale
+func (d *Database) ListTemplates(ctx context.Context, name, locale string) ([]model.Template, error) {
+	var conditions []string
+	var args []interface{}
+	if name != "" {
+		args = append(args, name)
+		conditions = append(conditions, fmt.Sprintf("name = $%d", len(args)))
+	}
+	if locale != "" {
+		args = append(args, locale)
+		conditions = append(conditions, fmt.Sprintf("lower(locale) = lower($%d)", len(args)))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	templates := []model.Template{}
+	err := d.db.SelectContext(ctx, &templates, `
+		SELECT `+templateColumns+`
+		FROM templates
+		`+where+`
+		ORDER BY name, locale, version`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+	return templates, nil
+}
+
+func (d *Database) DeleteTemplate(ctx context.Context, id string) error {
+	result, err := d.db.ExecContext(ctx, `DELETE FROM templates WHERE id::text = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete template: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"notification-system/pkg/model"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const webhookEventColumns = `id, notification_id::text AS notification_id, event, url, payload, attempts, next_attempt_at, delivered_at, last_error, created_at`
+
+// CreateWebhookEvent stores a webhook event, so it is delivered to its callback URL
+func (d *Database) CreateWebhookEvent(ctx context.Context, e model.WebhookEvent) error {
+	_, err := d.db.ExecContext(ctx, `
+		INSERT INTO webhook_events (notification_id, event, url, payload)
+		VALUES ($1, $2, $3, $4)`,
+		e.NotificationID, e.Event, e.URL, []byte(e.Payload))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook event: %w", err)
+	}
+	return nil
+}
+
+// ClaimWebhookEvents returns up to limit undelivered webhook events that are due and have attempts
+// left. Their next attempt is pushed back by the lease, so other workers skip them while they are
+// being delivered.
+func (d *Database) ClaimWebhookEvents(ctx context.Context, limit, maxAttempts int, lease time.Duration) ([]model.WebhookEvent, error) {
+	events := []model.WebhookEvent{}
+	err := d.db.SelectContext(ctx, &events, `
+		UPDATE webhook_events SET next_attempt_at = $1
+		WHERE id IN (
+			SELECT id FROM webhook_events
+			WHERE delivered_at IS NULL AND attempts < $2 AND next_attempt_at <= now()
+			ORDER BY next_attempt_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+webhookEventColumns,
+		time.Now().Add(lease), maxAttempts, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook events: %w", err)
+	}
+	return events, nil
+}
+
+// RecordWebhookAttempt adds a delivery attempt to a webhook event. A delivered event is done,
+// otherwise it is tried again at nextAttemptAt.
+func (d *Database) RecordWebhookAttempt(ctx context.Context, a model.WebhookAttempt, delivered bool, nextAttemptAt time.Time) error {
+	tx, err := d.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.NamedExecContext(ctx, `
+		INSERT INTO webhook_attempts (event_id, attempted_at, duration_ms, status_code, error)
+		VALUES (:event_id, :attempted_at, :duration_ms, :status_code, :error)`, a)
+	if err != nil {
+		return fmt.Errorf("failed to record webhook attempt: %w", err)
+	}
+
+	var deliveredAt *time.Time
+	if delivered {
+		deliveredAt = &a.AttemptedAt
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE webhook_events SET attempts = attempts + 1, delivered_at = $1, last_error = $2, next_attempt_at = $3
+		WHERE id = $4`,
+		deliveredAt, a.Error, nextAttemptAt, a.EventID)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook event: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit webhook attempt: %w", err)
+	}
+	return nil
+}
+
+// ListWebhookEvents returns the webhook events of a notification with their delivery attempts,
+// oldest first
+func (d *Database) ListWebhookEvents(ctx context.Context, notificationID string) ([]model.WebhookEvent, error) {
+	events := []model.WebhookEvent{}
+	err := d.db.SelectContext(ctx, &events, `
+		SELECT `+webhookEventColumns+`
+		FROM webhook_events
+		WHERE notification_id::text = $1
+		ORDER BY created_at, id`, notificationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook events: %w", err)
+	}
+	if len(events) == 0 {
+		return events, nil
+	}
+
+	ids := make([]int64, len(events))
+	index := make(map[int64]int, len(events))
+	for i, e := range events {
+		ids[i] = e.ID
+		index[e.ID] = i
+	}
+
+	var attempts []model.WebhookAttempt
+	err = d.db.SelectContext(ctx, &attempts, `
+		SELECT id, event_id, attempted_at, duration_ms, status_code, error
+		FROM webhook_attempts
+		WHERE event_id = ANY($1)
+		ORDER BY attempted_at, id`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook attempts: %w", err)
+	}
+	for _, a := range attempts {
+		i := index[a.EventID]
+		events[i].DeliveryAttempts = append(events[i].DeliveryAttempts, a)
+	}
+	return events, nil
+}
@@ -0,0 +1,135 @@
+package stream
+
+import (
+	"encoding/json"
+	"log"
+	"notification-system/pkg/model"
+	"sync"
+
+	"github.com/lib/pq"
+)
+
+// subscriberBuffer is the number of status changes a subscriber can fall behind before it is dropped
+const subscriberBuffer = 256
+
+// Filter selects the status changes a subscriber receives. Empty fields match everything.
+type Filter struct {
+	ClientID string
+	Channels map[model.NotificationChannel]bool
+	IDs      map[string]bool
+}
+
+// Matches reports whether a status change passes the filter
+func (f Filter) Matches(change model.StatusChange) bool {
+	if f.ClientID != "" && (change.ClientID == nil || *change.ClientID != f.ClientID) {
+		return false
+	}
+	if len(f.Channels) > 0 && !f.Channels[change.Channel] {
+		return false
+	}
+	if len(f.IDs) > 0 && !f.IDs[change.ID] {
+		return false
+	}
+	return true
+}
+
+type subscription struct {
+	filter  Filter
+	changes chan model.StatusChange
+}
+
+// Broker fans out the status changes published by Postgres to the subscribers of this instance.
+// Every API instance runs its own broker, so subscribers see the changes written by all instances
+// and workers.
+type Broker struct {
+	listener *pq.Listener
+
+	mu            sync.Mutex
+	subscriptions map[*subscription]bool
+	// stopped is set once the listener is closed, later subscribers get a closed channel
+	stopped bool
+}
+
+func NewBroker(listener *pq.Listener) *Broker {
+	return &Broker{
+		listener:      listener,
+		subscriptions: make(map[*subscription]bool),
+	}
+}
+
+// Start distributes status changes until the listener is closed
+func (b *Broker) Start() {
+	for notification := range b.listener.Notify {
+		if notification == nil {
+			log.Printf("Status listener reconnected, status changes may have been missed")
+			continue
+		}
+
+		var change model.StatusChange
+		if err := json.Unmarshal([]byte(notification.Extra), &change); err != nil {
+			log.Printf("Failed to decode status change: %v", err)
+			continue
+		}
+		b.publish(change)
+	}
+
+	// Let the subscribers know that no more changes will come
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.stopped = true
+	for sub := range b.subscriptions {
+		close(sub.changes)
+		delete(b.subscriptions, sub)
+	}
+}
+
+// Close closes the listener, which ends Start and the streams of all subscribers
+func (b *Broker) Close() error {
+	return b.listener.Close()
+}
+
+// Subscribe returns the status changes matching the filter and a function to stop receiving them.
+// The channel is closed when the subscriber falls too far behind or the broker stops.
+func (b *Broker) Subscribe(filter Filter) (<-chan model.StatusChange, func()) {
+	sub := &subscription{
+		filter:  filter,
+		changes: make(chan model.StatusChange, subscriberBuffer),
+	}
+
+	b.mu.Lock()
+	if b.stopped {
+		close(sub.changes)
+	} else {
+		b.subscriptions[sub] = true
+	}
+	b.mu.Unlock()
+
+	return sub.changes, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.subscriptions[sub] {
+			delete(b.subscriptions, sub)
+			close(sub.changes)
+		}
+	}
+}
+
+func (b *Broker) publish(change model.StatusChange) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subscriptions {
+		if !sub.filter.Matches(change) {
+			continue
+		}
+		select {
+		case sub.changes <- change:
+		default:
+			// Dropping a change silently would leave a stale view behind, so the subscriber is
+			// disconnected instead and can subscribe again
+			log.Printf("Dropping status subscriber that fell %d changes behind", subscriberBuffer)
+			delete(b.subscriptions, sub)
+			close(sub.changes)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package stream
+
+import (
+	"notification-system/pkg/model"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Broker", func() {
+	client := "billing"
+	sms := model.StatusChange{ID: "a", Channel: model.ChannelSMS, Status: model.StatusSent, ClientID: &client}
+	email := model.StatusChange{ID: "b", Channel: model.ChannelEmail, Status: model.StatusFailed}
+
+	Describe("Filter", func() {
+		It("should match everything when empty", func() {
+			Expect(Filter{}.Matches(sms)).To(BeTrue())
+			Expect(Filter{}.Matches(email)).To(BeTrue())
+		})
+
+		It("should match by channel", func() {
+			filter := Filter{Channels: map[model.NotificationChannel]bool{model.ChannelSMS: true}}
+			Expect(filter.Matches(sms)).To(BeTrue())
+			Expect(filter.Matches(email)).To(BeFalse())
+		})
+
+		It("should match by client", func() {
+			filter := Filter{ClientID: client}
+			Expect(filter.Matches(sms)).To(BeTrue())
+			Expect(filter.Matches(email)).To(BeFalse())
+		})
+
+		It("should match by notification ID", func() {
+			filter := Filter{IDs: map[string]bool{"b": true}}
+			Expect(filter.Matches(sms)).To(BeFalse())
+			Expect(filter.Matches(email)).To(BeTrue())
+		})
+	})
+
+	It("should deliver matching changes to subscribers", func() {
+		broker := NewBroker(nil)
+		changes, unsubscribe := broker.Subscribe(Filter{IDs: map[string]bool{"a": true}})
+		defer unsubscribe()
+
+		broker.publish(email)
+		broker.publish(sms)
+		Expect(changes).To(Receive(Equal(sms)))
+		Expect(changes).NotTo(Receive())
+	})
+
+	It("should close the channel on unsubscribe", func() {
+		broker := NewBroker(nil)
+		changes, unsubscribe := broker.Subscribe(Filter{})
+		unsubscribe()
+		unsubscribe()
+		Expect(changes).To(BeClosed())
+	})
+
+	It("should drop subscribers that fall behind", func() {
+		broker := NewBroker(nil)
+		changes, unsubscribe := broker.Subscribe(Filter{})
+		defer unsubscribe()
+
+		for i := 0; i <= subscriberBuffer; i++ {
+			broker.publish(sms)
+		}
+		for i := 0; i < subscriberBuffer; i++ {
+			Expect(changes).To(Receive())
+		}
+		Expect(changes).To(BeClosed())
+	})
+
+	It("should close the channel of subscribers arriving after the broker stopped", func() {
+		broker := NewBroker(nil)
+		broker.stopped = true
+		changes, unsubscribe := broker.Subscribe(Filter{})
+		defer unsubscribe()
+		Expect(changes).To(BeClosed())
+	})
+})
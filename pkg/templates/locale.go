@@ -0,0 +1,49 @@
+package templates
+
+import "strings"
+
+// NormalizeLocale returns a locale in the usual BCP 47 casing with hyphens, e.g. "pt_br" gives
+// "pt-BR" and "zh-hant-tw" gives "zh-Hant-TW": the language in lower case, the script in title case
+// and the region in upper case.
+func NormalizeLocale(locale string) string {
+	parts := strings.Split(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"), "-")
+	for i, part := range parts {
+		switch {
+		case i == 0:
+			parts[i] = strings.ToLower(part)
+		case len(part) == 2:
+			parts[i] = strings.ToUpper(part)
+		case len(part) == 4:
+			parts[i] = strings.ToUpper(part[:1]) + strings.ToLower(part[1:])
+		default:
+			parts[i] = strings.ToLower(part)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// LocaleCandidates returns the normalized locales to try, in order, when resolving a template for
+// locale: the locale itself, its base language and finally the default locale. For example "de-at"
+// with the default "en" gives ["de-AT", "de", "en"].
+func LocaleCandidates(locale, defaultLocale string) []string {
+	var candidates []string
+	add := func(l string) {
+		if l = NormalizeLocale(l); l == "" {
+			return
+		}
+		for _, c := range candidates {
+			if c == l {
+				return
+			}
+		}
+		candidates = append(candidates, l)
+	}
+
+	add(locale)
+	if base, _, found := strings.Cut(NormalizeLocale(locale), "-"); found {
+		add(base)
+	}
+	add(defaultLocale)
+
+	return candidates
+}
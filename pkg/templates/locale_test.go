@@ -0,0 +1,37 @@
+package templates
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LocaleCandidates", func() {
+	It("should fall back to the base language and the default locale", func() {
+		Expect(LocaleCandidates("de-AT", "en")).To(Equal([]string{"de-AT", "de", "en"}))
+	})
+
+	It("should accept underscores as separator", func() {
+		Expect(LocaleCandidates("pt_BR", "en")).To(Equal([]string{"pt-BR", "pt", "en"}))
+	})
+
+	It("should normalize the casing of the locales", func() {
+		Expect(LocaleCandidates("en-us", "EN")).To(Equal([]string{"en-US", "en"}))
+	})
+
+	It("should not repeat the default locale", func() {
+		Expect(LocaleCandidates("en-US", "en")).To(Equal([]string{"en-US", "en"}))
+	})
+
+	It("should use the default locale when no locale is requested", func() {
+		Expect(LocaleCandidates("", "en")).To(Equal([]string{"en"}))
+	})
+})
+
+var _ = Describe("NormalizeLocale", func() {
+	It("should use the usual casing and hyphens", func() {
+		Expect(NormalizeLocale("EN_us")).To(Equal("en-US"))
+		Expect(NormalizeLocale("zh-hant-tw")).To(Equal("zh-Hant-TW"))
+		Expect(NormalizeLocale("de")).To(Equal("de"))
+		Expect(NormalizeLocale("")).To(Equal(""))
+	})
+})
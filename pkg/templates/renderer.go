@@ -0,0 +1,197 @@
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"notification-system/pkg/model"
+	"text/template"
+)
+
+// Render renders the body of the template for the channel of the notification using its variables.
+// The rendered text replaces the notification message, while the email subject, email HTML and Slack
+// blocks are stored in the notification metadata for the providers.
+func Render(t *model.Template, notification *model.Notification) error {
+	vars := notification.Variables
+
+	// Copy the metadata, since it can be shared with other notifications
+	metadata := make(map[string]string, len(notification.Metadata)+2)
+	for key, value := range notification.Metadata {
+		metadata[key] = value
+	}
+
+	var message string
+	var err error
+	switch notification.Channel {
+	case model.ChannelSMS:
+		if t.SMSBody == "" {
+			return fmt.Errorf("template %s has no SMS body", t.Name)
+		}
+		if message, err = renderText("smsBody", t.SMSBody, vars); err != nil {
+			return err
+		}
+	case model.ChannelEmail:
+		if t.EmailText == "" {
+			return fmt.Errorf("template %s has no email body", t.Name)
+		}
+		if message, err = renderText("emailText", t.EmailText, vars); err != nil {
+			return err
+		}
+		if t.EmailSubject != "" {
+			if metadata[model.MetadataEmailSubject], err = renderText("emailSubject", t.EmailSubject, vars); err != nil {
+				return err
+			}
+		}
+		if t.EmailHTML != "" {
+			if metadata[model.MetadataEmailHTML], err = renderHTML("emailHtml", t.EmailHTML, vars); err != nil {
+				return err
+			}
+		}
+	case model.ChannelSlack:
+		if t.SlackText == "" {
+			return fmt.Errorf("template %s has no Slack body", t.Name)
+		}
+		if message, err = renderText("slackText", t.SlackText, vars); err != nil {
+			return err
+		}
+		if len(t.SlackBlocks) > 0 {
+			if metadata[model.MetadataSlackBlocks], err = renderBlocks(t.SlackBlocks, vars); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("templates are not supported for channel %s", notification.Channel)
+	}
+
+	notification.Message = message
+	notification.Metadata = metadata
+	return nil
+}
+
+// RenderFallback renders the template of a notification again for the target of its fallback chain
+// set as its channel and recipient. The rich content rendered from the template for the previous
+// channel is dropped first, so an email body or Slack blocks do not end up in another channel.
+func RenderFallback(t *model.Template, notification *model.Notification) error {
+	metadata := make(map[string]string, len(notification.Metadata))
+	for key, value := range notification.Metadata {
+		metadata[key] = value
+	}
+	if t.EmailSubject != "" {
+		delete(metadata, model.MetadataEmailSubject)
+	}
+	if t.EmailHTML != "" {
+		delete(metadata, model.MetadataEmailHTML)
+	}
+	if len(t.SlackBlocks) > 0 {
+		delete(metadata, model.MetadataSlackBlocks)
+	}
+
+	notification.Metadata = metadata
+	return Render(t, notification)
+}
+
+// Validate checks that all bodies of a template can be parsed
+func Validate(t *model.Template) error {
+	if t.Name == "" {
+		return fmt.Errorf("name cannot be empty")
+	}
+	if t.SMSBody == "" && t.EmailText == "" && t.SlackText == "" {
+		return fmt.Errorf("template needs at least one of smsBody, emailText or slackText")
+	}
+
+	for name, body := range map[string]string{
+		"smsBody":      t.SMSBody,
+		"emailSubject": t.EmailSubject,
+		"emailText":    t.EmailText,
+		"slackText":    t.SlackText,
+	} {
+		if _, err := template.New(name).Parse(body); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+	if _, err := htmltemplate.New("emailHtml").Parse(t.EmailHTML); err != nil {
+		return fmt.Errorf("invalid emailHtml: %w", err)
+	}
+	if len(t.SlackBlocks) > 0 {
+		var blocks []interface{}
+		if err := json.Unmarshal(t.SlackBlocks, &blocks); err != nil {
+			return fmt.Errorf("slackBlocks must be a JSON array: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func renderText(name, body string, vars map[string]interface{}) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(body)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", fmt.Errorf("failed to render %s: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+func renderHTML(name, body string, vars map[string]interface{}) (string, error) {
+	tmpl, err := htmltemplate.New(name).Option("missingkey=error").Parse(body)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", fmt.Errorf("failed to render %s: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+// renderBlocks renders every string in the Slack blocks JSON on its own, so the variables are
+// escaped properly when the blocks are encoded again
+func renderBlocks(blocks json.RawMessage, vars map[string]interface{}) (string, error) {
+	var decoded interface{}
+	if err := json.Unmarshal(blocks, &decoded); err != nil {
+		return "", fmt.Errorf("failed to parse slackBlocks: %w", err)
+	}
+
+	rendered, err := renderValue(decoded, vars)
+	if err != nil {
+		return "", err
+	}
+
+	encoded, err := json.Marshal(rendered)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode slackBlocks: %w", err)
+	}
+	return string(encoded), nil
+}
+
+func renderValue(value interface{}, vars map[string]interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return renderText("slackBlocks", v, vars)
+	case []interface{}:
+		for i := range v {
+			rendered, err := renderValue(v[i], vars)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = rendered
+		}
+		return v, nil
+	case map[string]interface{}:
+		for key := range v {
+			rendered, err := renderValue(v[key], vars)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = rendered
+		}
+		return v, nil
+	default:
+		return v, nil
+	}
+}
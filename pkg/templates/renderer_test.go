@@ -0,0 +1,134 @@
+package templates
+
+import (
+	"encoding/json"
+	"notification-system/pkg/model"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Render", func() {
+	var template *model.Template
+
+	BeforeEach(func() {
+		template = &model.Template{
+			Name:         "order-shipped",
+			SMSBody:      "Hi {{.name}}, order {{.order}} has shipped",
+			EmailSubject: "Order {{.order}} shipped",
+			EmailText:    "Hi {{.name}}, your order has shipped",
+			EmailHTML:    "<p>Hi {{.name}}, your order has shipped</p>",
+			SlackText:    "Order {{.order}} shipped",
+			SlackBlocks:  json.RawMessage(`[{"type":"section","text":{"type":"mrkdwn","text":"*{{.name}}*"}}]`),
+		}
+	})
+
+	Context("with an SMS notification", func() {
+		It("should render the SMS body into the message", func() {
+			notification := &model.Notification{
+				Channel:   model.ChannelSMS,
+				Variables: map[string]interface{}{"name": "Ann", "order": 42},
+			}
+			err := Render(template, notification)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(notification.Message).To(Equal("Hi Ann, order 42 has shipped"))
+		})
+
+		It("should return an error for a missing variable", func() {
+			notification := &model.Notification{
+				Channel:   model.ChannelSMS,
+				Variables: map[string]interface{}{"name": "Ann"},
+			}
+			err := Render(template, notification)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("failed to render smsBody"))
+		})
+	})
+
+	Context("with an email notification", func() {
+		It("should render the subject and escape variables in the HTML body", func() {
+			notification := &model.Notification{
+				Channel:   model.ChannelEmail,
+				Metadata:  map[string]string{"category": "orders"},
+				Variables: map[string]interface{}{"name": "<b>Ann</b>", "order": 42},
+			}
+			err := Render(template, notification)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(notification.Message).To(Equal("Hi <b>Ann</b>, your order has shipped"))
+			Expect(notification.Metadata).To(HaveKeyWithValue(model.MetadataEmailSubject, "Order 42 shipped"))
+			Expect(notification.Metadata).To(HaveKeyWithValue(model.MetadataEmailHTML, "<p>Hi &lt;b&gt;Ann&lt;/b&gt;, your order has shipped</p>"))
+			Expect(notification.Metadata).To(HaveKeyWithValue("category", "orders"))
+		})
+	})
+
+	Context("with a Slack notification", func() {
+		It("should render the strings inside the blocks", func() {
+			notification := &model.Notification{
+				Channel:   model.ChannelSlack,
+				Variables: map[string]interface{}{"name": `Ann "the admin"`, "order": 42},
+			}
+			err := Render(template, notification)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(notification.Message).To(Equal("Order 42 shipped"))
+			Expect(notification.Metadata[model.MetadataSlackBlocks]).To(MatchJSON(`[{"type":"section","text":{"type":"mrkdwn","text":"*Ann \"the admin\"*"}}]`))
+		})
+	})
+
+	Context("with a channel the template has no body for", func() {
+		It("should return an error", func() {
+			template.SMSBody = ""
+			notification := &model.Notification{Channel: model.ChannelSMS}
+			err := Render(template, notification)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("has no SMS body"))
+		})
+	})
+
+	Context("when falling back to another channel", func() {
+		It("should drop the rich content rendered for the previous channel", func() {
+			notification := &model.Notification{
+				Channel:   model.ChannelEmail,
+				Metadata:  map[string]string{"category": "orders"},
+				Variables: map[string]interface{}{"name": "Ann", "order": 42},
+			}
+			Expect(Render(template, notification)).To(Succeed())
+
+			notification.Channel = model.ChannelSMS
+			Expect(RenderFallback(template, notification)).To(Succeed())
+			Expect(notification.Message).To(Equal("Hi Ann, order 42 has shipped"))
+			Expect(notification.Metadata).NotTo(HaveKey(model.MetadataEmailSubject))
+			Expect(notification.Metadata).NotTo(HaveKey(model.MetadataEmailHTML))
+			Expect(notification.Metadata).To(HaveKeyWithValue("category", "orders"))
+		})
+
+		It("should keep rich content the template does not render", func() {
+			template.EmailSubject = ""
+			notification := &model.Notification{
+				Channel:   model.ChannelEmail,
+				Metadata:  map[string]string{model.MetadataEmailSubject: "Your order"},
+				Variables: map[string]interface{}{"name": "Ann", "order": 42},
+			}
+			Expect(RenderFallback(template, notification)).To(Succeed())
+			Expect(notification.Metadata).To(HaveKeyWithValue(model.MetadataEmailSubject, "Your order"))
+		})
+	})
+})
+
+var _ = Describe("Validate", func() {
+	It("should accept a template with a single body", func() {
+		err := Validate(&model.Template{Name: "welcome", SMSBody: "Welcome {{.name}}"})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should return an error for a template without bodies", func() {
+		err := Validate(&model.Template{Name: "welcome"})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("at least one of"))
+	})
+
+	It("should return an error for a body that does not parse", func() {
+		err := Validate(&model.Template{Name: "welcome", SMSBody: "Welcome {{.name"})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("invalid smsBody"))
+	})
+})
@@ -3,7 +3,11 @@ package validation
 import (
 	"fmt"
 	"notification-system/pkg/model"
+	"notification-system/pkg/quiethours"
+	"net"
+	"net/url"
 	"regexp"
+	"strings"
 )
 
 var (
@@ -25,33 +29,209 @@ func NewNotificationValidator() Validator {
 	return &NotificationValidator{}
 }
 
-// Validate performs validation on a notification
+// Validate performs validation on a notification and its fallback targets. The fallback targets of
+// templated notifications are only checked for their recipient, since the template is rendered
+// again for their channel, and that rendering has to be validated on its own.
 func (v *NotificationValidator) Validate(notification *model.Notification) error {
+	switch notification.Priority {
+	case "", model.PriorityLow, model.PriorityNormal, model.PriorityHigh, model.PriorityCritical:
+	default:
+		return fmt.Errorf("unknown priority: %s", notification.Priority)
+	}
+
+	if notification.CallbackURL != nil {
+		if err := validateCallbackURL(*notification.CallbackURL); err != nil {
+			return err
+		}
+	}
+
+	if err := v.validateTarget(notification); err != nil {
+		return err
+	}
+
+	for i, target := range notification.Fallback {
+		if notification.TemplateID != nil {
+			if err := requireContact(target.Channel, target.Recipient); err != nil {
+				return fmt.Errorf("fallback %d: %w", i, err)
+			}
+			continue
+		}
+
+		fallback := *notification
+		fallback.Channel = target.Channel
+		fallback.Recipient = target.Recipient
+		if err := v.validateTarget(&fallback); err != nil {
+			return fmt.Errorf("fallback %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// validateTarget validates the message for the channel and recipient of a notification
+func (v *NotificationValidator) validateTarget(notification *model.Notification) error {
 	if notification.Message == "" {
 		return fmt.Errorf("message cannot be empty")
 	}
 
-	if notification.Recipient == "" {
+	if err := requireContact(notification.Channel, notification.Recipient); err != nil {
+		return err
+	}
+
+	// Check message length (SMS has character limits)
+	if notification.Channel == model.ChannelSMS && len(notification.Message) > 160 {
+		return fmt.Errorf("SMS message exceeds 160 character limit")
+	}
+
+	return nil
+}
+
+// requireContact checks that a recipient is given and is a valid contact for the channel
+func requireContact(channel model.NotificationChannel, recipient string) error {
+	if recipient == "" {
 		return fmt.Errorf("recipient cannot be empty")
 	}
+	return validateContact(channel, recipient)
+}
 
-	switch notification.Channel {
-	case model.ChannelEmail:
-		if !emailRegex.MatchString(notification.Recipient) {
-			return fmt.Errorf("invalid email address format: %s", notification.Recipient)
+// ValidateRecipient validates the contact points and channel preferences of a directory recipient
+func ValidateRecipient(recipient *model.Recipient) error {
+	if recipient.ID == "" {
+		return fmt.Errorf("id cannot be empty")
+	}
+
+	contacts := map[model.NotificationChannel]*string{
+		model.ChannelEmail: recipient.Email,
+		model.ChannelSMS:   recipient.Phone,
+		model.ChannelSlack: recipient.SlackChannel,
+	}
+	for channel, contact := range contacts {
+		if contact == nil {
+			continue
 		}
-	case model.ChannelSMS:
-		if !phoneRegex.MatchString(notification.Recipient) {
-			return fmt.Errorf("invalid phone number format: %s. Must be in E.164 format", notification.Recipient)
+		if err := validateContact(channel, *contact); err != nil {
+			return err
+		}
+	}
+
+	for _, channel := range recipient.Preferences {
+		if _, ok := contacts[channel]; !ok {
+			return fmt.Errorf("unknown channel in preferences: %s", channel)
 		}
+	}
 
-		// Check message length (SMS has character limits)
-		if len(notification.Message) > 160 {
-			return fmt.Errorf("SMS message exceeds 160 character limit")
+	timeZone := ""
+	if recipient.TimeZone != nil {
+		timeZone = *recipient.TimeZone
+	}
+	return quiethours.Validate(timeZone, recipient.QuietHours)
+}
+
+// ValidateSuppression validates the channel and recipient of a suppression
+func ValidateSuppression(suppression *model.Suppression) error {
+	switch suppression.Channel {
+	case model.ChannelEmail, model.ChannelSMS, model.ChannelSlack:
+	default:
+		return fmt.Errorf("unknown channel: %s", suppression.Channel)
+	}
+
+	if suppression.Recipient == "" {
+		return fmt.Errorf("recipient cannot be empty")
+	}
+
+	if suppression.Category != nil && *suppression.Category == "" {
+		return fmt.Errorf("category cannot be empty")
+	}
+
+	return validateContact(suppression.Channel, suppression.Recipient)
+}
+
+// validateCallbackURL checks that a callback URL is an absolute http or https URL that does not
+// point at this host or a private network. Host names are checked again by the dispatcher when it
+// connects, since they can resolve to any address.
+func validateCallbackURL(callbackURL string) error {
+	u, err := url.Parse(callbackURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid callback URL: %s", callbackURL)
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("callback URL must not point at a private address: %s", callbackURL)
+	}
+	if ip := net.ParseIP(host); ip != nil && !IsPublicIP(ip) {
+		return fmt.Errorf("callback URL must not point at a private address: %s", callbackURL)
+	}
+	return nil
+}
+
+// nonPublicNetworks are the address ranges that cannot be reached from outside or must not be, since
+// they lead into the local or the provider network
+var nonPublicNetworks = parseNetworks(
+	"0.0.0.0/8",       // this network
+	"10.0.0.0/8",      // private
+	"100.64.0.0/10",   // carrier-grade NAT
+	"127.0.0.0/8",     // loopback
+	"169.254.0.0/16",  // link-local
+	"172.16.0.0/12",   // private
+	"192.0.0.0/24",    // protocol assignments
+	"192.0.2.0/24",    // documentation
+	"192.168.0.0/16",  // private
+	"198.18.0.0/15",   // benchmarking
+	"198.51.100.0/24", // documentation
+	"203.0.113.0/24",  // documentation
+	"224.0.0.0/4",     // multicast
+	"240.0.0.0/4",     // reserved and broadcast
+	"::/128",          // unspecified
+	"::1/128",         // loopback
+	"64:ff9b::/96",    // NAT64, reaches IPv4 addresses through the gateway
+	"64:ff9b:1::/48",  // local NAT64
+	"2001:db8::/32",   // documentation
+	"fc00::/7",        // unique local
+	"fe80::/10",       // link-local
+	"ff00::/8",        // multicast
+)
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+// IsPublicIP reports whether an IP address can be reached from outside, i.e. it is in none of the
+// nonPublicNetworks. IPv4-mapped IPv6 addresses are checked as the IPv4 address they map.
+func IsPublicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateContact validates the format of a recipient for a channel
+func validateContact(channel model.NotificationChannel, recipient string) error {
+	switch channel {
+	case model.ChannelEmail:
+		if !emailRegex.MatchString(recipient) {
+			return fmt.Errorf("invalid email address format: %s", recipient)
+		}
+	case model.ChannelSMS:
+		if !phoneRegex.MatchString(recipient) {
+			return fmt.Errorf("invalid phone number format: %s. Must be in E.164 format", recipient)
 		}
 	case model.ChannelSlack:
-		if !slackChannelIDRegex.MatchString(notification.Recipient) {
-			return fmt.Errorf("invalid slack channel ID format: %s. Must start with C or G followed by 8-10 alphanumeric characters", notification.Recipient)
+		if !slackChannelIDRegex.MatchString(recipient) {
+			return fmt.Errorf("invalid slack channel ID format: %s. Must start with C or G followed by 8-10 alphanumeric characters", recipient)
 		}
 	}
 
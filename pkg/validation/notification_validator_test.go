@@ -1,7 +1,9 @@
 package validation
 
 import (
+	"net"
 	"notification-system/pkg/model"
+	"strings"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -149,6 +151,61 @@ var _ = Describe("NotificationValidator", func() {
 				Expect(err.Error()).To(ContainSubstring("invalid slack channel ID format"))
 			})
 		})
+
+		Context("with a templated notification", func() {
+			It("should only check the recipients of the fallback targets", func() {
+				templateID := "7a0c3a52-1f3e-4a55-9a55-5b7f3c1f0c11"
+				notification := &model.Notification{
+					Channel:    model.ChannelEmail,
+					Recipient:  "test@example.com",
+					Message:    strings.Repeat("An email body longer than an SMS. ", 10),
+					TemplateID: &templateID,
+					Fallback: []model.Target{
+						{Channel: model.ChannelSMS, Recipient: "+1234567890"},
+					},
+				}
+				Expect(validator.Validate(notification)).To(Succeed())
+
+				notification.Fallback[0].Recipient = "not-a-phone"
+				Expect(validator.Validate(notification)).To(MatchError(ContainSubstring("fallback 0")))
+			})
+		})
+	})
+
+	Describe("Fallback targets", func() {
+		Context("with valid fallback targets", func() {
+			It("should validate successfully", func() {
+				notification := &model.Notification{
+					Channel:   model.ChannelSMS,
+					Recipient: "+1234567890",
+					Message:   "Test message",
+					Fallback: []model.Target{
+						{Channel: model.ChannelEmail, Recipient: "test@example.com"},
+						{Channel: model.ChannelSlack, Recipient: "C123456789"},
+					},
+				}
+				err := validator.Validate(notification)
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("with an invalid fallback target", func() {
+			It("should return an error naming the fallback", func() {
+				notification := &model.Notification{
+					Channel:   model.ChannelSMS,
+					Recipient: "+1234567890",
+					Message:   "Test message",
+					Fallback: []model.Target{
+						{Channel: model.ChannelEmail, Recipient: "test@example.com"},
+						{Channel: model.ChannelSlack, Recipient: "X123456789"},
+					},
+				}
+				err := validator.Validate(notification)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("fallback 1"))
+				Expect(err.Error()).To(ContainSubstring("invalid slack channel ID format"))
+			})
+		})
 	})
 
 	Describe("Common validation", func() {
@@ -177,5 +234,229 @@ var _ = Describe("NotificationValidator", func() {
 				Expect(err.Error()).To(ContainSubstring("recipient cannot be empty"))
 			})
 		})
+
+		Context("with unknown priority", func() {
+			It("should return an error", func() {
+				notification := &model.Notification{
+					Channel:   model.ChannelEmail,
+					Recipient: "test@example.com",
+					Message:   "Test message",
+					Priority:  "urgent",
+				}
+				err := validator.Validate(notification)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("unknown priority"))
+			})
+		})
+
+		Context("with a callback URL", func() {
+			It("should accept an https URL", func() {
+				callbackURL := "https://example.com/hooks/notifications"
+				notification := &model.Notification{
+					Channel:     model.ChannelEmail,
+					Recipient:   "test@example.com",
+					Message:     "Test message",
+					CallbackURL: &callbackURL,
+				}
+				Expect(validator.Validate(notification)).To(Succeed())
+			})
+
+			It("should reject a URL without an http scheme", func() {
+				callbackURL := "ftp://example.com/hooks"
+				notification := &model.Notification{
+					Channel:     model.ChannelEmail,
+					Recipient:   "test@example.com",
+					Message:     "Test message",
+					CallbackURL: &callbackURL,
+				}
+				err := validator.Validate(notification)
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("invalid callback URL"))
+			})
+
+			It("should reject a relative URL", func() {
+				callbackURL := "/hooks"
+				notification := &model.Notification{
+					Channel:     model.ChannelEmail,
+					Recipient:   "test@example.com",
+					Message:     "Test message",
+					CallbackURL: &callbackURL,
+				}
+				Expect(validator.Validate(notification)).NotTo(Succeed())
+			})
+
+			It("should reject URLs pointing at private addresses", func() {
+				for _, callbackURL := range []string{
+					"http://localhost:8080/hooks",
+					"http://127.0.0.1/hooks",
+					"http://10.0.0.5/hooks",
+					"http://169.254.169.254/latest/meta-data",
+					"http://[::1]/hooks",
+					"http://0.0.0.0/hooks",
+				} {
+					notification := &model.Notification{
+						Channel:     model.ChannelEmail,
+						Recipient:   "test@example.com",
+						Message:     "Test message",
+						CallbackURL: &callbackURL,
+					}
+					Expect(validator.Validate(notification)).To(MatchError(ContainSubstring("private address")), callbackURL)
+				}
+			})
+		})
+	})
+}) 
+var _ = Describe("ValidateRecipient", func() {
+	var email, phone string
+
+	BeforeEach(func() {
+		email = "test@example.com"
+		phone = "+1234567890"
 	})
-}) 
\ No newline at end of file
+
+	Context("with valid contact points", func() {
+		It("should validate successfully", func() {
+			recipient := &model.Recipient{
+				ID:          "user-1",
+				Email:       &email,
+				Phone:       &phone,
+				Preferences: []model.NotificationChannel{model.ChannelSMS, model.ChannelEmail},
+			}
+			err := ValidateRecipient(recipient)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("with an invalid contact point", func() {
+		It("should return an error", func() {
+			phone = "1234567890"
+			recipient := &model.Recipient{ID: "user-1", Phone: &phone}
+			err := ValidateRecipient(recipient)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("invalid phone number format"))
+		})
+	})
+
+	Context("with an unknown preferred channel", func() {
+		It("should return an error", func() {
+			recipient := &model.Recipient{
+				ID:          "user-1",
+				Email:       &email,
+				Preferences: []model.NotificationChannel{"fax"},
+			}
+			err := ValidateRecipient(recipient)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("unknown channel in preferences"))
+		})
+	})
+
+	Context("with invalid quiet hours", func() {
+		It("should return an error", func() {
+			recipient := &model.Recipient{
+				ID:         "user-1",
+				Email:      &email,
+				QuietHours: []model.QuietWindow{{Start: "22:00", End: "7am"}},
+			}
+			err := ValidateRecipient(recipient)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("must be HH:MM"))
+		})
+	})
+
+	Context("without an ID", func() {
+		It("should return an error", func() {
+			err := ValidateRecipient(&model.Recipient{Email: &email})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("id cannot be empty"))
+		})
+	})
+})
+
+var _ = Describe("ValidateSuppression", func() {
+	Context("with a valid suppression", func() {
+		It("should validate successfully", func() {
+			category := "marketing"
+			suppression := &model.Suppression{
+				Channel:   model.ChannelEmail,
+				Recipient: "test@example.com",
+				Category:  &category,
+			}
+			err := ValidateSuppression(suppression)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("with an unknown channel", func() {
+		It("should return an error", func() {
+			suppression := &model.Suppression{Channel: "fax", Recipient: "+1234567890"}
+			err := ValidateSuppression(suppression)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("unknown channel"))
+		})
+	})
+
+	Context("with a recipient invalid for the channel", func() {
+		It("should return an error", func() {
+			suppression := &model.Suppression{Channel: model.ChannelSMS, Recipient: "test@example.com"}
+			err := ValidateSuppression(suppression)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("invalid phone number format"))
+		})
+	})
+
+	Context("with an empty category", func() {
+		It("should return an error", func() {
+			category := ""
+			suppression := &model.Suppression{Channel: model.ChannelEmail, Recipient: "test@example.com", Category: &category}
+			err := ValidateSuppression(suppression)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("category cannot be empty"))
+		})
+	})
+})
+
+var _ = Describe("IsPublicIP", func() {
+	DescribeTable("should reject addresses that are not public",
+		func(address string) {
+			Expect(IsPublicIP(net.ParseIP(address))).To(BeFalse())
+		},
+		Entry("this network", "0.1.2.3"),
+		Entry("private 10/8", "10.0.0.5"),
+		Entry("carrier-grade NAT", "100.64.0.1"),
+		Entry("end of carrier-grade NAT", "100.127.255.254"),
+		Entry("loopback", "127.0.0.1"),
+		Entry("link-local", "169.254.169.254"),
+		Entry("private 172.16/12", "172.16.0.1"),
+		Entry("protocol assignments", "192.0.0.1"),
+		Entry("IPv4 documentation", "192.0.2.1"),
+		Entry("private 192.168/16", "192.168.1.1"),
+		Entry("benchmarking", "198.18.0.1"),
+		Entry("end of benchmarking", "198.19.255.254"),
+		Entry("second IPv4 documentation", "198.51.100.1"),
+		Entry("third IPv4 documentation", "203.0.113.1"),
+		Entry("multicast", "224.0.0.1"),
+		Entry("reserved", "240.0.0.1"),
+		Entry("broadcast", "255.255.255.255"),
+		Entry("IPv4-mapped private", "::ffff:10.0.0.5"),
+		Entry("unspecified", "::"),
+		Entry("IPv6 loopback", "::1"),
+		Entry("NAT64", "64:ff9b::a00:5"),
+		Entry("NAT64 of a public address", "64:ff9b::808:808"),
+		Entry("local NAT64", "64:ff9b:1::1"),
+		Entry("IPv6 documentation", "2001:db8::1"),
+		Entry("unique local", "fd00::1"),
+		Entry("IPv6 link-local", "fe80::1"),
+		Entry("IPv6 multicast", "ff02::1"),
+	)
+
+	DescribeTable("should accept public addresses",
+		func(address string) {
+			Expect(IsPublicIP(net.ParseIP(address))).To(BeTrue())
+		},
+		Entry("IPv4", "8.8.8.8"),
+		Entry("next to carrier-grade NAT", "100.128.0.1"),
+		Entry("next to benchmarking", "198.20.0.1"),
+		Entry("IPv4-mapped", "::ffff:8.8.8.8"),
+		Entry("IPv6", "2001:4860:4860::8888"),
+	)
+})
@@ -0,0 +1,222 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"notification-system/pkg/config"
+	"notification-system/pkg/model"
+	"notification-system/pkg/storage"
+	"notification-system/pkg/validation"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultMaxAttempts  = 8
+	defaultInitialDelay = time.Second
+	defaultMaxDelay     = 10 * time.Minute
+	defaultTimeout      = 5 * time.Second
+	defaultPollInterval = time.Second
+	defaultBatchSize    = 50
+	// claimMargin is added to the request timeout to get the time a claimed event is left alone
+	claimMargin = 30 * time.Second
+)
+
+// Dispatcher posts the stored webhook events to their callback URLs. Failed deliveries are retried
+// with exponential backoff until they succeed or run out of attempts.
+type Dispatcher struct {
+	db     *storage.Database
+	client *http.Client
+	config config.WebhookConfig
+}
+
+func NewDispatcher(db *storage.Database, cfg config.WebhookConfig) *Dispatcher {
+	return &Dispatcher{
+		db:     db,
+		config: cfg,
+		client: &http.Client{
+			Timeout: durationOr(time.Duration(cfg.TimeoutSeconds)*time.Second, defaultTimeout),
+			// Callback URLs are chosen by clients, so they must not reach this host or a private
+			// network. The address is checked when connecting, after the host name was resolved.
+			Transport: &http.Transport{
+				DialContext: (&net.Dialer{
+					Timeout:   30 * time.Second,
+					KeepAlive: 30 * time.Second,
+					Control:   publicOnly,
+				}).DialContext,
+				ForceAttemptHTTP2:     true,
+				MaxIdleConns:          100,
+				IdleConnTimeout:       90 * time.Second,
+				TLSHandshakeTimeout:   10 * time.Second,
+				ExpectContinueTimeout: time.Second,
+			},
+			// A redirect is not followed, the callback URL has to accept the event itself
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// publicOnly refuses connections to addresses that are not public
+func publicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !validation.IsPublicIP(ip) {
+		return fmt.Errorf("callback URL resolves to the private address %s", host)
+	}
+	return nil
+}
+
+// Start polls for due webhook events until the context is done. Without a signing secret no events
+// are posted, since their receivers could not tell them from forged ones.
+func (d *Dispatcher) Start(ctx context.Context) {
+	if d.config.SigningSecret == "" {
+		fmt.Println("WEBHOOK_SIGNING_SECRET is not set, webhook events are not delivered")
+		return
+	}
+
+	ticker := time.NewTicker(durationOr(time.Duration(d.config.PollIntervalMs)*time.Millisecond, defaultPollInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.dispatch(ctx)
+		}
+	}
+}
+
+// dispatch delivers the due webhook events. A batch in progress is finished when the context is
+// done, but no further batches are claimed.
+func (d *Dispatcher) dispatch(stop context.Context) {
+	batchSize := d.config.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	// Keep going while full batches are being delivered, so a backlog is drained quickly
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		events, err := d.db.ClaimWebhookEvents(ctx, batchSize, d.maxAttempts(), d.client.Timeout+claimMargin)
+		cancel()
+		if err != nil {
+			fmt.Printf("Failed to claim webhook events: %v\n", err)
+			return
+		}
+
+		// A slow receiver only holds up the events of its own batch
+		var wg sync.WaitGroup
+		for _, event := range events {
+			wg.Add(1)
+			go func(event model.WebhookEvent) {
+				defer wg.Done()
+				d.deliver(event)
+			}(event)
+		}
+		wg.Wait()
+
+		if len(events) < batchSize || stop.Err() != nil {
+			return
+		}
+	}
+}
+
+// deliver posts a webhook event to its callback URL and records the attempt
+func (d *Dispatcher) deliver(event model.WebhookEvent) {
+	attempt := model.WebhookAttempt{
+		EventID:     event.ID,
+		AttemptedAt: time.Now(),
+	}
+	statusCode, err := d.post(event, attempt.AttemptedAt)
+	attempt.DurationMs = time.Since(attempt.AttemptedAt).Milliseconds()
+	if statusCode != 0 {
+		attempt.StatusCode = &statusCode
+	}
+
+	delivered := err == nil
+	nextAttemptAt := attempt.AttemptedAt
+	if !delivered {
+		errorMsg := err.Error()
+		attempt.Error = &errorMsg
+		nextAttemptAt = time.Now().Add(d.retryDelay(event.Attempts + 1))
+
+		if event.Attempts+1 >= d.maxAttempts() {
+			fmt.Printf("Giving up on webhook event %d of notification %s after %d attempts: %v\n", event.ID, event.NotificationID, event.Attempts+1, err)
+		} else {
+			fmt.Printf("Failed to deliver webhook event %d of notification %s: %v\n", event.ID, event.NotificationID, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := d.db.RecordWebhookAttempt(ctx, attempt, delivered, nextAttemptAt); err != nil {
+		// The event is claimed again once the claim expires
+		fmt.Printf("Failed to record attempt of webhook event %d: %v\n", event.ID, err)
+	}
+}
+
+// post sends the signed event and returns the response status. Any status other than 2xx is an error.
+func (d *Dispatcher) post(event model.WebhookEvent, now time.Time) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, event.URL, bytes.NewReader(event.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("invalid callback URL: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event.Event)
+	req.Header.Set(IDHeader, strconv.FormatInt(event.ID, 10))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(SignatureHeader, Sign(d.config.SigningSecret, now, event.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("callback URL responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// maxAttempts returns the number of times an event is posted before giving up on it
+func (d *Dispatcher) maxAttempts() int {
+	if d.config.MaxAttempts <= 0 {
+		return defaultMaxAttempts
+	}
+	return d.config.MaxAttempts
+}
+
+// retryDelay returns the exponential backoff before the given attempt, starting from 1 for the
+// first retry
+func (d *Dispatcher) retryDelay(attempt int) time.Duration {
+	initialDelay := durationOr(time.Duration(d.config.InitialDelayMs)*time.Millisecond, defaultInitialDelay)
+	maxDelay := durationOr(time.Duration(d.config.MaxDelayMs)*time.Millisecond, defaultMaxDelay)
+
+	delay := time.Duration(float64(initialDelay) * math.Pow(2, float64(attempt-1)))
+	if delay > maxDelay || delay <= 0 {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// durationOr returns d, or the fallback if d is not set
+func durationOr(d, fallback time.Duration) time.Duration {
+	if d <= 0 {
+		return fallback
+	}
+	return d
+}
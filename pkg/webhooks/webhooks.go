@@ -0,0 +1,85 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"notification-system/pkg/model"
+	"strconv"
+	"time"
+)
+
+// Headers of the requests posted to callback URLs
+const (
+	EventHeader     = "X-Webhook-Event"
+	IDHeader        = "X-Webhook-ID"
+	TimestampHeader = "X-Webhook-Timestamp"
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+// eventStatuses are the notification statuses reported to callback URLs
+var eventStatuses = map[model.NotificationStatus]bool{
+	model.StatusSent:        true,
+	model.StatusFailed:      true,
+	model.StatusDelivered:   true,
+	model.StatusBounced:     true,
+	model.StatusUndelivered: true,
+}
+
+// Payload is the JSON body of a webhook event
+type Payload struct {
+	Event             string                    `json:"event"`
+	NotificationID    string                    `json:"notificationId"`
+	MessageID         *string                   `json:"messageId,omitempty"`
+	Channel           model.NotificationChannel `json:"channel"`
+	Recipient         string                    `json:"recipient"`
+	Status            model.NotificationStatus  `json:"status"`
+	Attempts          int                       `json:"attempts"`
+	Error             *string                   `json:"error,omitempty"`
+	ProviderMessageID *string                   `json:"providerMessageId,omitempty"`
+	OccurredAt        time.Time                 `json:"occurredAt"`
+}
+
+// NewEvent returns the webhook event for the current status of a notification, and false if the
+// notification has no callback URL or its status is not reported
+func NewEvent(n model.Notification) (model.WebhookEvent, bool, error) {
+	if n.CallbackURL == nil || *n.CallbackURL == "" || !eventStatuses[n.Status] {
+		return model.WebhookEvent{}, false, nil
+	}
+
+	payload, err := json.Marshal(Payload{
+		Event:             "notification." + string(n.Status),
+		NotificationID:    n.ID,
+		MessageID:         n.MessageID,
+		Channel:           n.Channel,
+		Recipient:         n.Recipient,
+		Status:            n.Status,
+		Attempts:          n.Attempts,
+		Error:             n.LastError,
+		ProviderMessageID: n.ProviderMessageID,
+		OccurredAt:        time.Now().UTC(),
+	})
+	if err != nil {
+		return model.WebhookEvent{}, false, fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	return model.WebhookEvent{
+		NotificationID: n.ID,
+		Event:          "notification." + string(n.Status),
+		URL:            *n.CallbackURL,
+		Payload:        payload,
+	}, true, nil
+}
+
+// Sign returns the signature header of a webhook request: the hex encoded HMAC-SHA256 of
+// "<timestamp>.<body>" with the signing secret. Receivers recompute it to verify the request, and
+// reject old timestamps to prevent replays.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
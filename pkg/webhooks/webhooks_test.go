@@ -0,0 +1,136 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"notification-system/pkg/config"
+	"notification-system/pkg/model"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Webhooks", func() {
+	Describe("NewEvent", func() {
+		var callbackURL string
+		var notification model.Notification
+
+		BeforeEach(func() {
+			callbackURL = "https://example.com/hooks"
+			notification = model.Notification{
+				ID:          "3f0b8d4e-2f7c-4a59-9a43-0d1d3c3e6a10",
+				Channel:     model.ChannelEmail,
+				Recipient:   "test@example.com",
+				Status:      model.StatusSent,
+				Attempts:    1,
+				CallbackURL: &callbackURL,
+			}
+		})
+
+		It("should describe the status of the notification", func() {
+			event, ok, err := NewEvent(notification)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(event.Event).To(Equal("notification.sent"))
+			Expect(event.URL).To(Equal(callbackURL))
+
+			var payload Payload
+			Expect(json.Unmarshal(event.Payload, &payload)).To(Succeed())
+			Expect(payload.NotificationID).To(Equal(notification.ID))
+			Expect(payload.Status).To(Equal(model.StatusSent))
+			Expect(payload.Attempts).To(Equal(1))
+		})
+
+		It("should skip notifications without a callback URL", func() {
+			notification.CallbackURL = nil
+			_, ok, err := NewEvent(notification)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		})
+
+		It("should skip statuses that are not reported", func() {
+			notification.Status = model.StatusScheduled
+			_, ok, err := NewEvent(notification)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Describe("Sign", func() {
+		timestamp := time.Unix(1700000000, 0)
+		body := []byte(`{"event":"notification.sent"}`)
+
+		It("should be stable for the same input", func() {
+			Expect(Sign("secret", timestamp, body)).To(Equal(Sign("secret", timestamp, body)))
+			Expect(Sign("secret", timestamp, body)).To(HavePrefix("sha256="))
+		})
+
+		It("should depend on the secret, timestamp and body", func() {
+			signature := Sign("secret", timestamp, body)
+			Expect(Sign("other", timestamp, body)).NotTo(Equal(signature))
+			Expect(Sign("secret", timestamp.Add(time.Second), body)).NotTo(Equal(signature))
+			Expect(Sign("secret", timestamp, []byte(`{}`))).NotTo(Equal(signature))
+		})
+	})
+
+	Describe("Dispatcher", func() {
+		It("should back off exponentially up to the maximum delay", func() {
+			d := NewDispatcher(nil, config.WebhookConfig{InitialDelayMs: 1000, MaxDelayMs: 5000})
+			Expect(d.retryDelay(1)).To(Equal(time.Second))
+			Expect(d.retryDelay(2)).To(Equal(2 * time.Second))
+			Expect(d.retryDelay(3)).To(Equal(4 * time.Second))
+			Expect(d.retryDelay(4)).To(Equal(5 * time.Second))
+		})
+
+		It("should post signed events", func() {
+			var received *http.Request
+			var receivedBody []byte
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received = r
+				receivedBody, _ = io.ReadAll(r.Body)
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer server.Close()
+
+			d := NewDispatcher(nil, config.WebhookConfig{SigningSecret: "secret"})
+			d.client.Transport = server.Client().Transport
+			event := model.WebhookEvent{ID: 7, Event: "notification.sent", URL: server.URL, Payload: []byte(`{"status":"sent"}`)}
+			now := time.Now()
+			status, err := d.post(event, now)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status).To(Equal(http.StatusNoContent))
+			Expect(received.Header.Get(EventHeader)).To(Equal("notification.sent"))
+			Expect(received.Header.Get(IDHeader)).To(Equal("7"))
+			Expect(received.Header.Get(SignatureHeader)).To(Equal(Sign("secret", now, receivedBody)))
+		})
+
+		It("should fail on responses other than 2xx", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			}))
+			defer server.Close()
+
+			d := NewDispatcher(nil, config.WebhookConfig{})
+			d.client.Transport = server.Client().Transport
+			status, err := d.post(model.WebhookEvent{URL: server.URL, Payload: []byte(`{}`)}, time.Now())
+			Expect(err).To(HaveOccurred())
+			Expect(status).To(Equal(http.StatusInternalServerError))
+		})
+
+		It("should not connect to private addresses", func() {
+			var called bool
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			}))
+			defer server.Close()
+
+			d := NewDispatcher(nil, config.WebhookConfig{SigningSecret: "secret"})
+			_, err := d.post(model.WebhookEvent{URL: server.URL, Payload: []byte(`{}`)}, time.Now())
+			Expect(err).To(MatchError(ContainSubstring("private address")))
+			Expect(called).To(BeFalse())
+		})
+	})
+})
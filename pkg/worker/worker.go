@@ -3,22 +3,38 @@ package worker
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"notification-system/pkg/config"
 	"notification-system/pkg/model"
 	"notification-system/pkg/providers"
 	"notification-system/pkg/queue"
+	"notification-system/pkg/quiethours"
 	"notification-system/pkg/storage"
+	"notification-system/pkg/templates"
+	"notification-system/pkg/webhooks"
+	"sync"
 	"time"
+
+	"github.com/google/uuid"
 )
 
+// defaultShutdownTimeout is how long notifications in progress get to finish on shutdown
+const defaultShutdownTimeout = 30 * time.Second
+
+// minRetryDelay is the backoff used when no retry delay is configured
+const minRetryDelay = time.Millisecond
+
 type Worker struct {
-	db          *storage.Database
-	queue       *queue.QueueClient
-	notifier    *providers.NotificationStrategyContext
-	config      config.RetryConfig
-	dlqPrefix   string
+	db        *storage.Database
+	queue     *queue.QueueClient
+	notifier  *providers.NotificationStrategyContext
+	config    config.RetryConfig
+	consumers map[model.NotificationChannel]config.ConsumerConfig
+	dlqPrefix string
+	// shutdownTimeout is how long Start waits for notifications in progress once it is stopped
+	shutdownTimeout time.Duration
 }
 
 func NewWorker(
@@ -26,61 +42,158 @@ func NewWorker(
 	q *queue.QueueClient,
 	notifier *providers.NotificationStrategyContext,
 	config config.RetryConfig,
+	consumers map[model.NotificationChannel]config.ConsumerConfig,
 	dlqPrefix string,
+	shutdownTimeout time.Duration,
 ) *Worker {
 	return &Worker{
-		db:         db,
-		queue:      q,
-		notifier:   notifier,
-		config:     config,
-		dlqPrefix:  dlqPrefix,
+		db:              db,
+		queue:           q,
+		notifier:        notifier,
+		config:          config,
+		consumers:       consumers,
+		dlqPrefix:       dlqPrefix,
+		shutdownTimeout: shutdownTimeout,
 	}
 }
 
-func (w *Worker) Start() {
-	// Start a goroutine for each channel type
-	go w.processChannel(model.ChannelSMS)
-	go w.processChannel(model.ChannelEmail)
-	go w.processChannel(model.ChannelSlack)
-	
-	// Keep the main thread alive
-	select {}
-}
+// Start processes notifications until the context is done. It then stops taking new messages and
+// waits up to the shutdown timeout for the ones in progress. Sends still running by then are
+// cancelled and their messages requeued, and Start only returns once all consumers stopped.
+func (w *Worker) Start(ctx context.Context) error {
+	// Failed messages wait in a retry queue per delay instead of blocking the consumer
+	if err := w.queue.DeclareRetryQueues(w.retryDelays()); err != nil {
+		return err
+	}
 
-func (w *Worker) processWithRetry(notification model.Notification) error {
-	var lastErr error
-	for attempt := 0; attempt < w.config.MaxRetries; attempt++ {
-		if attempt > 0 {
-			// Calculate delay with exponential backoff
-			delay := time.Duration(w.config.InitialDelayMs) * time.Millisecond * time.Duration(math.Pow(2, float64(attempt-1)))
-			if delay > time.Duration(w.config.MaxDelayMs)*time.Millisecond {
-				delay = time.Duration(w.config.MaxDelayMs) * time.Millisecond
-			}
-			time.Sleep(delay)
+	// Notifications in progress are processed until the shutdown timeout, not the end of ctx
+	processing, cancelProcessing := context.WithCancel(context.Background())
+	defer cancelProcessing()
+
+	// Start a pool of consumers for each channel type, every one with its own prefetch
+	var consumers sync.WaitGroup
+	for _, channel := range []model.NotificationChannel{model.ChannelSMS, model.ChannelEmail, model.ChannelSlack} {
+		consumer := w.consumers[channel]
+		for i := 0; i < max(consumer.Concurrency, 1); i++ {
+			consumers.Add(1)
+			go func() {
+				defer consumers.Done()
+				w.processChannel(ctx, processing, channel, consumer.Prefetch)
+			}()
 		}
+	}
 
-		// Create a context with timeout for each attempt
-		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(w.config.ProcessTimeout)*time.Second)
-		defer cancel()
+	<-ctx.Done()
 
-		err := w.process(ctx, notification)
-		if err == nil {
-			return nil
+	timeout := w.shutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	fmt.Printf("Stopping worker, waiting up to %s for notifications in progress\n", timeout)
+
+	if err := w.queue.StopConsuming(); err != nil {
+		fmt.Printf("Failed to stop consuming: %v\n", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		consumers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		fmt.Printf("Notifications still in progress after %s, cancelling them and requeueing their messages\n", timeout)
+		cancelProcessing()
+		<-done
+	}
+	fmt.Println("Worker stopped")
+	return nil
+}
+
+// maxAttempts returns the number of times a notification is tried before giving up on it
+func (w *Worker) maxAttempts() int {
+	return max(w.config.MaxRetries, 1)
+}
+
+// retryDelay returns the exponential backoff before the given attempt, starting from 1 for the
+// first retry. It is never shorter than minRetryDelay, since a message is only retried through a
+// retry queue with a delay.
+func (w *Worker) retryDelay(attempt int) time.Duration {
+	delay := time.Duration(w.config.InitialDelayMs) * time.Millisecond * time.Duration(math.Pow(2, float64(attempt-1)))
+	if delay > time.Duration(w.config.MaxDelayMs)*time.Millisecond {
+		delay = time.Duration(w.config.MaxDelayMs) * time.Millisecond
+	}
+	return max(delay, minRetryDelay)
+}
+
+// retryPolicy decides whether a failed notification is tried again as the given attempt and after
+// which delay. Permanent provider failures are not retried, and rate limited ones wait at least
+// as long as the provider asked for, up to the longest retry queue.
+func (w *Worker) retryPolicy(err error, attempt int) (time.Duration, bool) {
+	if providers.IsPermanent(err) || attempt >= w.maxAttempts() {
+		return 0, false
+	}
+
+	delay := w.retryDelay(attempt)
+	if retryAfter, ok := providers.RetryAfter(err); ok && retryAfter > delay {
+		delay = w.retryBucket(retryAfter)
+	}
+	return delay, true
+}
+
+// providerWaits are the retry queues for waits longer than the backoff, e.g. when a provider asks
+// for a long Retry-After
+var providerWaits = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute, time.Hour}
+
+// retryBucket returns the shortest retry delay that covers a wait, or the longest one if none does.
+// Waits are rounded to the declared retry queues, so they do not add a queue per distinct delay.
+func (w *Worker) retryBucket(wait time.Duration) time.Duration {
+	delays := w.retryDelays()
+	for _, delay := range delays {
+		if delay >= wait {
+			return delay
+		}
+	}
+	return delays[len(delays)-1]
+}
+
+// retryDelays returns the distinct delays of the retry queues in ascending order: the backoff
+// delays of all retries followed by the longer provider waits
+func (w *Worker) retryDelays() []time.Duration {
+	var delays []time.Duration
+	add := func(delay time.Duration) {
+		if delay > 0 && (len(delays) == 0 || delay > delays[len(delays)-1]) {
+			delays = append(delays, delay)
 		}
-		lastErr = err
-		fmt.Printf("Attempt %d failed: %v\n", attempt+1, err)
 	}
-	return fmt.Errorf("failed after %d attempts, last error: %v", w.config.MaxRetries, lastErr)
+	for attempt := 1; attempt < w.maxAttempts(); attempt++ {
+		add(w.retryDelay(attempt))
+	}
+	for _, delay := range providerWaits {
+		add(delay)
+	}
+	return delays
 }
 
-func (w *Worker) processChannel(channel model.NotificationChannel) {
-	msgs, err := w.queue.Consume(channel)
+// processChannel runs a single consumer of the queue of a channel until its deliveries end. Once the
+// context is done, the messages still delivered are requeued instead of processed. Every message is
+// processed with a context derived from processing, and requeued if processing ends while it runs.
+func (w *Worker) processChannel(ctx, processing context.Context, channel model.NotificationChannel, prefetch int) {
+	msgs, err := w.queue.Consume(channel, prefetch)
 	if err != nil {
 		fmt.Printf("Failed to consume messages for channel %s: %v\n", channel, err)
 		return
 	}
 
+	// Messages are delivered by priority, and a low prefetch keeps urgent ones from getting stuck
+	// behind a backlog
 	for msg := range msgs {
+		if ctx.Err() != nil {
+			msg.Nack(false, true)
+			continue
+		}
+
 		var notification model.Notification
 		if err := json.Unmarshal(msg.Body, &notification); err != nil {
 			fmt.Printf("Failed to unmarshal message for channel %s: %v\n", channel, err)
@@ -88,8 +201,57 @@ func (w *Worker) processChannel(channel model.NotificationChannel) {
 			continue
 		}
 
-		if err := w.processWithRetry(notification); err != nil {
-			fmt.Printf("Failed to process notification for channel %s after retries: %v\n", channel, err)
+		// Create a context with timeout for each attempt
+		attempt := queue.Attempt(msg)
+		ctx, cancel := context.WithTimeout(processing, time.Duration(w.config.ProcessTimeout)*time.Second)
+		err := w.process(ctx, notification, attempt)
+		cancel()
+
+		if processing.Err() != nil {
+			// Cancelled on shutdown, the message is processed again after the restart
+			msg.Nack(false, true)
+			continue
+		}
+
+		if wait, throttled := providers.IsThrottled(err); throttled {
+			// The provider was not reached, so the notification waits without using up an attempt
+			if err := w.queue.PublishRetry(notification, attempt, w.retryBucket(wait)); err != nil {
+				fmt.Printf("Failed to hold back throttled notification %s: %v\n", notification.ID, err)
+				msg.Nack(false, true) // Requeue the message to retry right away
+				continue
+			}
+			msg.Ack(false)
+			continue
+		}
+
+		if err != nil {
+			fmt.Printf("Attempt %d failed for notification %s: %v\n", attempt+1, notification.ID, err)
+
+			// Schedule a retry through the retry queue and move on with the next message
+			if delay, retry := w.retryPolicy(err, attempt+1); retry {
+				if err := w.queue.PublishRetry(notification, attempt+1, delay); err != nil {
+					fmt.Printf("Failed to schedule retry for notification %s: %v\n", notification.ID, err)
+					msg.Nack(false, true) // Requeue the message to retry right away
+					continue
+				}
+				msg.Ack(false)
+				continue
+			}
+
+			if providers.IsPermanent(err) {
+				fmt.Printf("Not retrying notification %s after a permanent failure\n", notification.ID)
+			} else {
+				fmt.Printf("Failed to process notification for channel %s after %d attempts: %v\n", channel, attempt+1, err)
+			}
+			w.reportFailure(notification, attempt+1, err)
+
+			// Continue with the next channel of the fallback chain instead of giving up
+			if len(notification.Fallback) > 0 {
+				if err := w.fallback(notification); err == nil {
+					msg.Ack(false)
+					continue
+				}
+			}
 			
 			// Send to DLQ after all retries are exhausted
 			msg.Nack(false, false) // Do not requeue. This will send the message to the DLQ	
@@ -103,20 +265,142 @@ func (w *Worker) processChannel(channel model.NotificationChannel) {
 	}
 }
 
-func (w *Worker) process(ctx context.Context, notification model.Notification) error {
+// fallback creates a follow-up notification for the first target of the fallback chain of a failed
+// notification, linked to it through FallbackFor. The remaining targets are passed on. Like the failed
+// notification it stands in for, it is not counted against the recipient limit again.
+func (w *Worker) fallback(notification model.Notification) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(w.config.ProcessTimeout)*time.Second)
+	defer cancel()
+
+	// Fallback targets without their own user belong to the user of the notification
+	userID := notification.Fallback[0].UserID
+	if userID == nil {
+		userID = notification.UserID
+	}
+
+	next := model.Notification{
+		ID:          uuid.New().String(),
+		Channel:     notification.Fallback[0].Channel,
+		Recipient:   notification.Fallback[0].Recipient,
+		Message:     notification.Message,
+		Metadata:    notification.Metadata,
+		TemplateID:  notification.TemplateID,
+		Variables:   notification.Variables,
+		Status:      model.StatusPending,
+		CreatedAt:   time.Now(),
+		MessageID:   notification.MessageID,
+		CallbackURL: notification.CallbackURL,
+		ClientID:    notification.ClientID,
+		Fallback:    notification.Fallback[1:],
+		FallbackFor: &notification.ID,
+		UserID:      userID,
+		Priority:    notification.Priority,
+	}
+
+	// The message and rich content were rendered for the channel of the failed notification
+	if next.TemplateID != nil {
+		template, err := w.db.GetTemplateByID(ctx, *next.TemplateID)
+		if err != nil {
+			fmt.Printf("Failed to load template of fallback notification for %s: %v\n", notification.ID, err)
+			return err
+		}
+		if err := templates.RenderFallback(template, &next); err != nil {
+			fmt.Printf("Failed to render fallback notification for %s: %v\n", notification.ID, err)
+			return err
+		}
+	}
+
+	if err := w.db.SaveNotification(ctx, next); err != nil {
+		fmt.Printf("Failed to save fallback notification for %s: %v\n", notification.ID, err)
+		return err
+	}
+	fmt.Printf("Falling back from %s (%s) to %s (%s)\n", notification.ID, notification.Channel, next.ID, next.Channel)
+
+	// The relay publishes the fallback notification if this fails
+	if err := w.queue.Publish(next); err != nil {
+		fmt.Printf("Failed to publish fallback notification %s, leaving it to the relay: %v\n", next.ID, err)
+		return nil
+	}
+	if err := w.db.MarkOutboxDispatched(ctx, next.ID); err != nil {
+		fmt.Printf("Failed to mark fallback notification %s as dispatched: %v\n", next.ID, err)
+	}
+	return nil
+}
+
+// process sends a notification that failed attempt times before. A failed send that is retried
+// leaves the notification pending, so only final failures are stored as failed.
+func (w *Worker) process(ctx context.Context, notification model.Notification, attempt int) error {
+	// Skip notifications cancelled after they were queued
+	stored, err := w.db.GetNotificationByID(ctx, notification.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load notification %s: %w", notification.ID, err)
+	}
+	if stored.Status == model.StatusCancelled {
+		fmt.Printf("Skipping cancelled notification %s\n", notification.ID)
+		return nil
+	}
+
+	// Skip recipients who opted out after the notification was queued
+	suppressed, err := w.db.IsSuppressed(ctx, notification)
+	if err != nil {
+		return fmt.Errorf("failed to check suppressions for notification %s: %w", notification.ID, err)
+	}
+	if suppressed {
+		fmt.Printf("Skipping suppressed notification %s\n", notification.ID)
+		// Only the status changes, the stored attempts and errors of earlier tries are kept
+		if dbErr := w.db.SetNotificationStatus(ctx, notification.ID, model.StatusSuppressed); dbErr != nil {
+			fmt.Printf("Failed to update notification status in database: %v\n", dbErr)
+			return dbErr
+		}
+		return nil
+	}
+
+	// Hold back notifications that would reach the recipient during their quiet hours
+	until, quiet, err := w.quietHoursEnd(ctx, notification)
+	if err != nil {
+		return err
+	}
+	if quiet {
+		fmt.Printf("Deferring notification %s until the end of the quiet hours at %s\n", notification.ID, until.Format(time.RFC3339))
+		return w.db.DeferNotification(ctx, notification, until)
+	}
+
 	// Send the notification
-	err := w.notifier.Send(ctx, notification)
-	notification.Attempts++
+	started := time.Now()
+	result, err := w.notifier.Send(ctx, notification)
+	if _, throttled := providers.IsThrottled(err); throttled {
+		return err
+	}
+	notification.Attempts = stored.Attempts + 1
 	now := time.Now()
 	notification.LastTried = &now
+	if result.ProviderMessageID != "" {
+		notification.ProviderMessageID = &result.ProviderMessageID
+	}
+
+	// The send may have used up the context, e.g. on a timeout, so its outcome is stored with a
+	// fresh one
+	storeCtx, cancel := context.WithTimeout(context.Background(), time.Duration(w.config.ProcessTimeout)*time.Second)
+	defer cancel()
+
+	w.recordAttempt(storeCtx, notification, started, now.Sub(started), err)
 
 	if err != nil {
 		// Update notification with error
 		notification.Status = model.StatusFailed
+		if _, retry := w.retryPolicy(err, attempt+1); retry {
+			notification.Status = model.StatusPending
+		}
 		errorMsg := err.Error()
 		notification.LastError = &errorMsg
 		
-		if dbErr := w.db.UpdateNotificationStatus(ctx, notification); dbErr != nil {
+		dbErr := w.db.UpdateNotificationStatus(storeCtx, notification)
+		if errors.Is(dbErr, storage.ErrCancelled) {
+			// Cancelled while it was sent, so it is not retried
+			fmt.Printf("Notification %s was cancelled during a failed attempt, not retrying it\n", notification.ID)
+			return nil
+		}
+		if dbErr != nil {
 			fmt.Printf("Failed to update notification status in database: %v\n", dbErr)
 		}
 		return err
@@ -124,10 +408,102 @@ func (w *Worker) process(ctx context.Context, notification model.Notification) e
 
 	// Update notification as successful
 	notification.Status = model.StatusSent
-	if dbErr := w.db.UpdateNotificationStatus(ctx, notification); dbErr != nil {
+	dbErr := w.db.UpdateNotificationStatus(storeCtx, notification)
+	if errors.Is(dbErr, storage.ErrCancelled) {
+		// The cancellation stays, and no webhook event reports the notification as sent
+		fmt.Printf("Notification %s was cancelled while it was sent\n", notification.ID)
+		return nil
+	}
+	if dbErr != nil {
 		fmt.Printf("Failed to update notification status in database: %v\n", dbErr)
 		return dbErr
 	}
+	w.queueWebhookEvent(storeCtx, notification)
 
 	return nil
 }
+
+// quietHoursEnd returns when the quiet hours of the recipient of a notification end, and false if
+// the notification can be sent now. Only notifications addressed to a user from the directory have
+// quiet hours, and only the ones of low or normal priority are held back, urgent ones are sent
+// right away.
+func (w *Worker) quietHoursEnd(ctx context.Context, notification model.Notification) (time.Time, bool, error) {
+	if notification.UserID == nil {
+		return time.Time{}, false, nil
+	}
+	switch notification.Priority {
+	case "", model.PriorityLow, model.PriorityNormal:
+	default:
+		return time.Time{}, false, nil
+	}
+
+	recipient, err := w.db.GetRecipientByID(ctx, *notification.UserID)
+	if errors.Is(err, storage.ErrNotFound) {
+		// The user was removed from the directory after the notification was created
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to load recipient %s: %w", *notification.UserID, err)
+	}
+	if len(recipient.QuietHours) == 0 {
+		return time.Time{}, false, nil
+	}
+
+	timeZone := ""
+	if recipient.TimeZone != nil {
+		timeZone = *recipient.TimeZone
+	}
+	loc, err := quiethours.Location(timeZone)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid time zone of recipient %s: %w", recipient.ID, err)
+	}
+	return quiethours.End(recipient.QuietHours, loc, time.Now())
+}
+
+// recordAttempt adds a send attempt to the delivery history of a notification. Failures are only
+// logged, so they do not cause the notification to be sent again.
+func (w *Worker) recordAttempt(ctx context.Context, notification model.Notification, started time.Time, duration time.Duration, sendErr error) {
+	attempt := model.NotificationAttempt{
+		NotificationID:    notification.ID,
+		Attempt:           notification.Attempts,
+		StartedAt:         started,
+		DurationMs:        duration.Milliseconds(),
+		ProviderMessageID: notification.ProviderMessageID,
+	}
+	if provider, err := w.notifier.GetStrategy(notification.Channel); err == nil {
+		attempt.Provider = provider.Name()
+	}
+	if sendErr != nil {
+		errorMsg := sendErr.Error()
+		attempt.Error = &errorMsg
+	}
+
+	if err := w.db.RecordAttempt(ctx, attempt); err != nil {
+		fmt.Printf("Failed to record attempt of notification %s: %v\n", notification.ID, err)
+	}
+}
+
+// reportFailure tells the callback URL of a notification that it failed for good
+func (w *Worker) reportFailure(notification model.Notification, attempts int, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(w.config.ProcessTimeout)*time.Second)
+	defer cancel()
+
+	errorMsg := err.Error()
+	notification.Status = model.StatusFailed
+	notification.Attempts = attempts
+	notification.LastError = &errorMsg
+	w.queueWebhookEvent(ctx, notification)
+}
+
+// queueWebhookEvent stores the webhook event for the new status of a notification, which the
+// dispatcher then posts to its callback URL. Failures are only logged, so they do not cause the
+// notification to be sent again.
+func (w *Worker) queueWebhookEvent(ctx context.Context, notification model.Notification) {
+	event, ok, err := webhooks.NewEvent(notification)
+	if err == nil && ok {
+		err = w.db.CreateWebhookEvent(ctx, event)
+	}
+	if err != nil {
+		fmt.Printf("Failed to queue webhook event of notification %s: %v\n", notification.ID, err)
+	}
+}
@@ -0,0 +1,101 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"notification-system/pkg/config"
+	"notification-system/pkg/model"
+	"notification-system/pkg/providers"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Retries", func() {
+	var w *Worker
+
+	BeforeEach(func() {
+		w = &Worker{config: config.RetryConfig{MaxRetries: 5, InitialDelayMs: 1000, MaxDelayMs: 5000}}
+	})
+
+	Describe("retryDelays", func() {
+		It("should list the backoff delays followed by the provider waits", func() {
+			Expect(w.retryDelays()).To(Equal([]time.Duration{
+				time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second,
+				time.Minute, 5 * time.Minute, 15 * time.Minute, time.Hour,
+			}))
+		})
+
+		It("should skip provider waits shorter than the backoff", func() {
+			w.config.MaxDelayMs = 600000
+			w.config.InitialDelayMs = 300000
+			Expect(w.retryDelays()).To(Equal([]time.Duration{
+				5 * time.Minute, 10 * time.Minute, 15 * time.Minute, time.Hour,
+			}))
+		})
+
+		It("should declare the minimal delay when no backoff is configured", func() {
+			w.config.InitialDelayMs = 0
+			w.config.MaxDelayMs = 0
+			Expect(w.retryDelays()).To(Equal([]time.Duration{
+				time.Millisecond, time.Minute, 5 * time.Minute, 15 * time.Minute, time.Hour,
+			}))
+		})
+	})
+
+	DescribeTable("retryBucket",
+		func(wait, expected time.Duration) {
+			Expect(w.retryBucket(wait)).To(Equal(expected))
+		},
+		Entry("rounds a short wait up to the first delay", 200*time.Millisecond, time.Second),
+		Entry("keeps a wait that matches a delay", 4*time.Second, 4*time.Second),
+		Entry("rounds up to the next delay", 4100*time.Millisecond, 5*time.Second),
+		Entry("rounds a long wait up to a provider wait", 90*time.Second, 5*time.Minute),
+		Entry("caps a wait at the longest delay", 3*time.Hour, time.Hour),
+	)
+
+	DescribeTable("retryPolicy",
+		func(err error, attempt int, expectedDelay time.Duration, expectedRetry bool) {
+			delay, retry := w.retryPolicy(err, attempt)
+			Expect(retry).To(Equal(expectedRetry))
+			Expect(delay).To(Equal(expectedDelay))
+		},
+		Entry("backs off on a transient failure", errors.New("timeout"), 2, 2*time.Second, true),
+		Entry("caps the backoff", errors.New("timeout"), 4, 5*time.Second, true),
+		Entry("gives up after the last attempt", errors.New("timeout"), 5, time.Duration(0), false),
+		Entry("does not retry a permanent failure", &providers.PermanentError{Err: errors.New("invalid number")}, 1, time.Duration(0), false),
+		Entry("waits for the retry-after of the provider",
+			&providers.RateLimitedError{Err: errors.New("too many requests"), RetryAfter: 30 * time.Second}, 1, time.Minute, true),
+		Entry("keeps the backoff when it is longer than the retry-after",
+			&providers.RateLimitedError{Err: errors.New("too many requests"), RetryAfter: 500 * time.Millisecond}, 3, 4*time.Second, true),
+	)
+
+	DescribeTable("retryPolicy without a configured backoff",
+		func(initialDelayMs, maxDelayMs int, attempt int, expectedDelay time.Duration) {
+			w.config.InitialDelayMs = initialDelayMs
+			w.config.MaxDelayMs = maxDelayMs
+			delay, retry := w.retryPolicy(errors.New("timeout"), attempt)
+			Expect(retry).To(BeTrue())
+			Expect(delay).To(Equal(expectedDelay))
+			Expect(w.retryDelays()).To(ContainElement(delay))
+		},
+		Entry("no delays", 0, 0, 1, time.Millisecond),
+		Entry("no initial delay", 0, 5000, 3, time.Millisecond),
+		Entry("no maximum delay", 1000, 0, 2, time.Millisecond),
+	)
+})
+
+var _ = Describe("quietHoursEnd", func() {
+	DescribeTable("should send urgent notifications right away",
+		func(priority model.NotificationPriority) {
+			userID := "user-1"
+			w := &Worker{}
+			_, quiet, err := w.quietHoursEnd(context.Background(), model.Notification{UserID: &userID, Priority: priority})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(quiet).To(BeFalse())
+		},
+		Entry("high", model.PriorityHigh),
+		Entry("critical", model.PriorityCritical),
+	)
+})
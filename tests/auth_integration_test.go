@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"notification-system/pkg/config"
+	"notification-system/pkg/model"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("API Key Integration Test", func() {
+	var (
+		apiURL           string
+		adminKey         string
+		notificationJSON []byte
+	)
+
+	ginkgo.BeforeEach(func() {
+		cfg, err := config.LoadConfig("../.env.test")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		notificationJSON, err = json.Marshal(model.Notification{
+			Channel:   model.ChannelEmail,
+			Recipient: "test@example.com",
+			Message:   "Test authenticated Email message",
+		})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		apiURL = fmt.Sprintf("http://localhost:%s", cfg.Server.Port)
+		adminKey = cfg.Server.AdminAPIKey
+	})
+
+	ginkgo.It("should reject requests without a valid API key", func() {
+		resp, err := apiRequest(http.MethodPost, fmt.Sprintf("%s/notifications", apiURL), "", notificationJSON)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusUnauthorized))
+
+		resp, err = apiRequest(http.MethodPost, fmt.Sprintf("%s/notifications", apiURL), "nsk_unknown", notificationJSON)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusUnauthorized))
+	})
+
+	ginkgo.It("should only show notifications to the client that created them", func() {
+		ownerKey := issueAPIKey(apiURL, adminKey, "integration-tests-owner")
+		otherKey := issueAPIKey(apiURL, adminKey, "integration-tests-other")
+
+		resp, err := apiRequest(http.MethodPost, fmt.Sprintf("%s/notifications", apiURL), ownerKey, notificationJSON)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusAccepted))
+
+		var response struct {
+			ID string `json:"id"`
+		}
+		gomega.Expect(json.NewDecoder(resp.Body).Decode(&response)).To(gomega.Succeed())
+		statusURL := fmt.Sprintf("%s/notifications/%s/status", apiURL, response.ID)
+
+		resp, err = apiRequest(http.MethodGet, statusURL, ownerKey, nil)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusOK))
+
+		resp, err = apiRequest(http.MethodGet, statusURL, otherKey, nil)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusNotFound))
+
+		resp, err = apiRequest(http.MethodGet, statusURL, adminKey, nil)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusOK))
+	})
+
+	ginkgo.It("should stop accepting a revoked API key", func() {
+		body, err := json.Marshal(map[string]string{"clientId": "integration-tests-revoked"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		resp, err := apiRequest(http.MethodPost, fmt.Sprintf("%s/api-keys", apiURL), adminKey, body)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusCreated))
+
+		var apiKey model.APIKey
+		gomega.Expect(json.NewDecoder(resp.Body).Decode(&apiKey)).To(gomega.Succeed())
+
+		// Client keys cannot manage keys
+		resp, err = apiRequest(http.MethodDelete, fmt.Sprintf("%s/api-keys/%s", apiURL, apiKey.ID), apiKey.Key, nil)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusForbidden))
+
+		resp, err = apiRequest(http.MethodDelete, fmt.Sprintf("%s/api-keys/%s", apiURL, apiKey.ID), adminKey, nil)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusOK))
+
+		resp, err = apiRequest(http.MethodPost, fmt.Sprintf("%s/notifications", apiURL), apiKey.Key, notificationJSON)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusUnauthorized))
+	})
+})
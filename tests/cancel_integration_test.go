@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"notification-system/pkg/config"
+	"notification-system/pkg/model"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Cancel Integration Test", func() {
+	var (
+		apiURL       string
+		apiKey       string
+		notification model.Notification
+	)
+
+	ginkgo.BeforeEach(func() {
+		cfg, err := config.LoadConfig("../.env.test")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// Set up a notification scheduled far enough in the future to cancel it
+		sendAt := time.Now().Add(time.Hour)
+		notification = model.Notification{
+			Channel:   model.ChannelEmail,
+			Recipient: "test@example.com",
+			Message:   "Test scheduled Email message",
+			SendAt:    &sendAt,
+		}
+
+		// Set API URL
+		apiURL = fmt.Sprintf("http://localhost:%s", cfg.Server.Port)
+		apiKey = issueAPIKey(apiURL, cfg.Server.AdminAPIKey, "integration-tests")
+	})
+
+	ginkgo.It("should cancel a scheduled notification", func() {
+		notificationJSON, err := json.Marshal(notification)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		resp, err := apiRequest(http.MethodPost, fmt.Sprintf("%s/notifications", apiURL), apiKey, notificationJSON)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusAccepted))
+
+		var response struct {
+			ID     string `json:"id"`
+			Status string `json:"status"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(response.Status).To(gomega.Equal(string(model.StatusScheduled)))
+
+		// Cancel the notification
+		req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/notifications/%s", apiURL, response.ID), nil)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		req.Header.Set(apiKeyHeader, apiKey)
+		resp, err = http.DefaultClient.Do(req)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusOK))
+
+		// Cancelling it a second time is a conflict
+		resp, err = http.DefaultClient.Do(req)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusConflict))
+
+		// Check notification status via API
+		resp, err = apiRequest(http.MethodGet, fmt.Sprintf("%s/notifications/%s/status", apiURL, response.ID), apiKey, nil)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusOK))
+
+		var statusResponse model.Notification
+		err = json.NewDecoder(resp.Body).Decode(&statusResponse)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(statusResponse.Status).To(gomega.Equal(model.StatusCancelled))
+		gomega.Expect(statusResponse.Attempts).To(gomega.Equal(0))
+	})
+})
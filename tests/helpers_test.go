@@ -0,0 +1,50 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/onsi/gomega"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+// issueAPIKey issues a key for the client through the admin endpoint
+func issueAPIKey(apiURL, adminKey, clientID string) string {
+	body, err := json.Marshal(map[string]string{"clientId": clientID, "name": "integration tests"})
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+	resp, err := apiRequest(http.MethodPost, fmt.Sprintf("%s/api-keys", apiURL), adminKey, body)
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	defer resp.Body.Close()
+	gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusCreated))
+
+	var response struct {
+		Key string `json:"key"`
+	}
+	gomega.Expect(json.NewDecoder(resp.Body).Decode(&response)).To(gomega.Succeed())
+	gomega.Expect(response.Key).NotTo(gomega.BeEmpty())
+	return response.Key
+}
+
+// apiRequest sends a request authenticated with the API key, with a JSON body if one is given
+func apiRequest(method, url, apiKey string, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewBuffer(body)
+	}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if apiKey != "" {
+		req.Header.Set(apiKeyHeader, apiKey)
+	}
+	return http.DefaultClient.Do(req)
+}
@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"notification-system/pkg/config"
+	"notification-system/pkg/model"
+
+	"github.com/google/uuid"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Idempotency Integration Test", func() {
+	var (
+		apiURL       string
+		apiKey       string
+		notification model.Notification
+	)
+
+	ginkgo.BeforeEach(func() {
+		cfg, err := config.LoadConfig("../.env.test")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// Set up test notification
+		notification = model.Notification{
+			Channel:   model.ChannelSMS,
+			Recipient: "+359896632259",
+			Message:   "Test idempotent SMS message",
+		}
+
+		// Set API URL
+		apiURL = fmt.Sprintf("http://localhost:%s", cfg.Server.Port)
+		apiKey = issueAPIKey(apiURL, cfg.Server.AdminAPIKey, "integration-tests")
+	})
+
+	ginkgo.It("should return the original notification for a repeated Idempotency-Key", func() {
+		notificationJSON, err := json.Marshal(notification)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		key := uuid.New().String()
+		send := func() (int, string) {
+			req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/notifications", apiURL), bytes.NewBuffer(notificationJSON))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Idempotency-Key", key)
+			req.Header.Set(apiKeyHeader, apiKey)
+
+			resp, err := http.DefaultClient.Do(req)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			defer resp.Body.Close()
+
+			var response struct {
+				ID string `json:"id"`
+			}
+			err = json.NewDecoder(resp.Body).Decode(&response)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			return resp.StatusCode, response.ID
+		}
+
+		firstStatus, firstID := send()
+		gomega.Expect(firstStatus).To(gomega.Equal(http.StatusAccepted))
+
+		secondStatus, secondID := send()
+		gomega.Expect(secondStatus).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(secondID).To(gomega.Equal(firstID))
+	})
+})
@@ -1,7 +1,6 @@
 package tests
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -18,6 +17,7 @@ var _ = ginkgo.Describe("Slack Integration Test", func() {
 	var (
 		db            *storage.Database
 		apiURL        string
+		apiKey        string
 		notification  model.Notification
 	)
 
@@ -37,6 +37,7 @@ var _ = ginkgo.Describe("Slack Integration Test", func() {
 
 		// Set API URL
 		apiURL = fmt.Sprintf("http://localhost:%s", cfg.Server.Port)
+		apiKey = issueAPIKey(apiURL, cfg.Server.AdminAPIKey, "integration-tests")
 	})
 
 	ginkgo.AfterEach(func() {
@@ -50,11 +51,7 @@ var _ = ginkgo.Describe("Slack Integration Test", func() {
 		notificationJSON, err := json.Marshal(notification)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
-		resp, err := http.Post(
-			fmt.Sprintf("%s/notifications", apiURL),
-			"application/json",
-			bytes.NewBuffer(notificationJSON),
-		)
+		resp, err := apiRequest(http.MethodPost, fmt.Sprintf("%s/notifications", apiURL), apiKey, notificationJSON)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusAccepted))
 
@@ -71,7 +68,7 @@ var _ = ginkgo.Describe("Slack Integration Test", func() {
 		time.Sleep(5 * time.Second)
 
 		// Check notification status via API
-		resp, err = http.Get(fmt.Sprintf("%s/notifications/%s/status", apiURL, response.ID))
+		resp, err = apiRequest(http.MethodGet, fmt.Sprintf("%s/notifications/%s/status", apiURL, response.ID), apiKey, nil)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 		gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusOK))
 